@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"math/big"
 	"os"
 	"time"
@@ -13,6 +15,8 @@ import (
 	"github.com/ethereum-optimism/optimism/op-node/rollup"
 	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
 	"github.com/ethereum-optimism/optimism/op-service/client"
+	"github.com/ethereum-optimism/optimism/op-service/ctxinterrupt"
+	oplog "github.com/ethereum-optimism/optimism/op-service/log"
 	"github.com/ethereum-optimism/optimism/op-service/sources"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
@@ -72,6 +76,14 @@ func main() {
 				},
 			},
 			Action: func(cliCtx *cli.Context) error {
+				inbox, err := parseAddress("inbox", cliCtx.String("inbox"))
+				if err != nil {
+					return err
+				}
+				sender, err := parseAddress("sender", cliCtx.String("sender"))
+				if err != nil {
+					return err
+				}
 				l1Client, err := ethclient.Dial(cliCtx.String("l1"))
 				if err != nil {
 					log.Fatal(err)
@@ -100,9 +112,9 @@ func main() {
 					End:     uint64(cliCtx.Int("end")),
 					ChainID: chainID,
 					BatchSenders: map[common.Address]struct{}{
-						common.HexToAddress(cliCtx.String("sender")): {},
+						sender: {},
 					},
-					BatchInbox:         common.HexToAddress(cliCtx.String("inbox")),
+					BatchInbox:         inbox,
 					OutDirectory:       cliCtx.String("out"),
 					ConcurrentRequests: uint64(cliCtx.Int("concurrent-requests")),
 				}
@@ -116,17 +128,56 @@ func main() {
 		{
 			Name:  "reassemble",
 			Usage: "Reassembles channels from fetched batch transactions and decode batches",
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				&cli.StringFlag{
 					Name:  "in",
 					Value: "/tmp/batch_decoder/transactions_cache",
-					Usage: "Cache directory for the found transactions",
+					Usage: "Cache directory for the found transactions, or an s3://bucket/prefix URL (requires a build with the s3 tag)",
+				},
+				&cli.StringSliceFlag{
+					Name:  "extra-in",
+					Usage: "(Optional) Further cache directories to read together with --in. Transactions present in several directories are loaded once",
+				},
+				&cli.StringFlag{
+					Name:    "s3-endpoint",
+					Usage:   "Endpoint of the S3-compatible object store of an s3:// input",
+					EnvVars: []string{"S3_ENDPOINT"},
+				},
+				&cli.StringFlag{
+					Name:    "s3-access-key-id",
+					Usage:   "Access key ID of the S3-compatible object store",
+					EnvVars: []string{"S3_ACCESS_KEY_ID"},
+				},
+				&cli.StringFlag{
+					Name:    "s3-access-key-secret",
+					Usage:   "Access key secret of the S3-compatible object store",
+					EnvVars: []string{"S3_ACCESS_KEY_SECRET"},
+				},
+				&cli.StringFlag{
+					Name:  "in-file",
+					Usage: "(Optional) File with one transaction per line to read instead of the cache directory",
+				},
+				&cli.StringFlag{
+					Name:  "in-archive",
+					Usage: "(Optional) Tar archive, optionally gzip compressed, of a cache directory to read instead of the cache directory",
 				},
 				&cli.StringFlag{
 					Name:  "out",
 					Value: "/tmp/batch_decoder/channel_cache",
 					Usage: "Cache directory for the found channels",
 				},
+				&cli.BoolFlag{
+					Name:  "write-transactions",
+					Usage: "Write transactions.json, listing the frames carried by each batcher transaction",
+				},
+				&cli.BoolFlag{
+					Name:  "write-block-frames",
+					Usage: "Write block_frames.json, listing the frames included in each L1 block",
+				},
+				&cli.StringFlag{
+					Name:  "batch-out",
+					Usage: "Directory to write a summary file per decoded batch into. No batch files are written if empty",
+				},
 				&cli.Uint64Flag{
 					Name:  "l2-chain-id",
 					Value: 10,
@@ -144,45 +195,356 @@ func main() {
 					Usage: "L2 block time for span batch derivation. Default value from op-mainnet. " +
 						"Superchain-registry prioritized when given value is inconsistent.",
 				},
-				&cli.StringFlag{
+				&cli.StringSliceFlag{
 					Name:  "inbox",
-					Value: "0xFF00000000000000000000000000000000000010",
-					Usage: "Batch Inbox Address. Default value from op-mainnet. " +
-						"Superchain-registry prioritized when given value is inconsistent.",
+					Value: cli.NewStringSlice("0xFF00000000000000000000000000000000000010"),
+					Usage: "Batch Inbox Address. May be repeated to load transactions of multiple inboxes. Default value from op-mainnet. " +
+						"Superchain-registry prioritized when a single given value is inconsistent.",
 				},
-			},
+				&cli.StringFlag{
+					Name:  "sender",
+					Usage: "(Optional) Only load the transactions of this batcher sender address",
+				},
+				&cli.Uint64Flag{
+					Name:  "start",
+					Usage: "(Optional) First L1 block (inclusive) of transactions to reassemble",
+				},
+				&cli.Uint64Flag{
+					Name:  "end",
+					Usage: "(Optional) Last L1 block (inclusive) of transactions to reassemble",
+				},
+				&cli.StringFlag{
+					Name:  "since",
+					Usage: "(Optional) Earliest L1 block time (inclusive, RFC3339) of transactions to reassemble",
+				},
+				&cli.StringFlag{
+					Name:  "until",
+					Usage: "(Optional) Latest L1 block time (inclusive, RFC3339) of transactions to reassemble",
+				},
+				&cli.IntFlag{
+					Name:  "concurrency",
+					Usage: "(Optional) Number of channels to process concurrently. Defaults to the number of CPUs",
+				},
+				&cli.StringFlag{
+					Name:  "output-format",
+					Value: reassemble.OutputFormatJSON,
+					Usage: "Output format: 'json' writes a file per channel, 'csv' writes the metadata of all frames to frames.csv, " +
+						"'ndjson' writes a channel per line to --single-file or stdout, " +
+						"'parquet' writes frames.parquet & channels.parquet (requires a build with -tags parquet,purego), " +
+						"'graph' writes a Graphviz graph of the channels & their transactions to channels.dot",
+				},
+				&cli.BoolFlag{
+					Name:  "timeline",
+					Usage: "Add the L1 arrival timeline of the frames to each channel",
+				},
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "Process all channels & print summary statistics without writing any files",
+				},
+				&cli.BoolFlag{
+					Name:  "legacy-batches",
+					Usage: "Decode the transactions included before the rollup genesis as pre-Bedrock batches",
+				},
+				&cli.BoolFlag{
+					Name:  "batch-types-only",
+					Usage: "Only report the batch types of each channel instead of decoding the batches",
+				},
+				&cli.BoolFlag{
+					Name:  "verify-round-trip",
+					Usage: "Re-encode the batches of ready channels & compare them with the decompressed channel data",
+				},
+				&cli.BoolFlag{
+					Name:  "include-raw-calldata",
+					Usage: "Attach the raw input of the carrying transaction to each frame",
+				},
+				&cli.BoolFlag{
+					Name:  "hex-frame-data",
+					Usage: "Encode the frame data as 0x-prefixed hex instead of base64",
+				},
+				&cli.StringFlag{
+					Name:  "gas-model",
+					Usage: "(Optional) Calldata gas model for the L1 gas of channels: eip2028 or eip7623. Defaults to the model active on L1 at the inclusion block",
+				},
+				&cli.Uint64Flag{
+					Name:  "l1-prague-time",
+					Usage: "(Optional) Prague activation time of L1, from which calldata is priced by EIP-7623. Defaults to the known time of the L1 chain",
+				},
+				&cli.BoolFlag{
+					Name:  "skip-empty-frames",
+					Usage: "Exclude frames without data from the channels",
+				},
+				&cli.IntFlag{
+					Name:  "max-frame-number",
+					Value: -1,
+					Usage: "(Optional) Truncate channels by dropping frames with a higher frame number. Negative values disable truncation",
+				},
+				&cli.BoolFlag{
+					Name:  "resume",
+					Usage: "Skip channels whose file already exists in the out directory & is valid",
+				},
+				&cli.StringFlag{
+					Name:  "sort-by",
+					Usage: "Order of processing & the index: block, frame_count or data_size",
+					Value: reassemble.SortByBlock,
+				},
+				&cli.StringFlag{
+					Name:  "filename-template",
+					Usage: "Go template of the channel filenames, with the fields .Name, .ID, .IDReuseIndex, .FirstInclusionBlock & .InboxAddr",
+					Value: reassemble.DefaultFilenameTemplate,
+				},
+				&cli.IntFlag{
+					Name:  "max-frames-per-channel",
+					Usage: "Maximum number of frames accepted per channel, frames past the limit are skipped",
+					Value: reassemble.DefaultMaxFramesPerChannel,
+				},
+				&cli.StringFlag{
+					Name:  "zlib-dictionary",
+					Usage: "(Optional) File holding the preset dictionary of zlib compressed channels, for batchers compressing with a shared dictionary",
+				},
+				&cli.Uint64Flag{
+					Name:  "max-frame-size",
+					Usage: "(Optional) Maximum frame size of the batcher, including the frame overhead. Enables the frame fill ratio of each channel",
+				},
+				&cli.Uint64SliceFlag{
+					Name:  "frame-size-buckets",
+					Usage: "(Optional) Upper bounds of the buckets of the frame size histogram of each channel",
+				},
+				&cli.Uint64Flag{
+					Name:  "max-rlp-bytes-per-channel",
+					Usage: "(Optional) Limit of the decompressed channel data, overriding the limit of the chain spec",
+				},
+				&cli.Int64Flag{
+					Name:  "max-output-bytes",
+					Usage: "(Optional) Stop with an error before the written channels exceed this many bytes. Requires the json or ndjson output format. Zero disables the limit",
+				},
+				&cli.BoolFlag{
+					Name:  "trace",
+					Usage: "Log the decision taken for every frame. Very verbose",
+				},
+				&cli.BoolFlag{
+					Name:  "verify-checksums",
+					Usage: "Verify each transaction file against its .sha256 sidecar file before decoding it",
+				},
+				&cli.BoolFlag{
+					Name:  "replay",
+					Usage: "Cross-check each channel by replaying its frames through the channel bank of the derivation pipeline",
+				},
+				&cli.BoolFlag{
+					Name:  "pretty",
+					Usage: "Indent the JSON output",
+				},
+				&cli.StringFlag{
+					Name:  "dump-payloads",
+					Usage: "(Optional) Directory to write the raw decompressed payload of each ready channel to",
+				},
+				&cli.BoolFlag{
+					Name:  "watch",
+					Usage: "Keep running & update the channels with the transaction files created in the input directory until interrupted",
+				},
+				&cli.BoolFlag{
+					Name:  "continue-on-error",
+					Usage: "Log transaction files which fail to load & channels which fail to be written as warnings instead of failing",
+				},
+				&cli.BoolFlag{
+					Name:  "timing",
+					Usage: "Log the duration of each phase of the run when it finishes",
+				},
+				&cli.BoolFlag{
+					Name:  "strict-ready",
+					Usage: "Only consider complete channels ready if their data decompresses",
+				},
+				&cli.BoolFlag{
+					Name:  "ready-only",
+					Usage: "Only write the channels which are ready. The other channels are still counted & listed in the error manifest",
+				},
+				&cli.IntFlag{
+					Name:  "sample",
+					Usage: "(Optional) Only write a random sample of this many channels. All channels are still counted & listed in the error manifest",
+				},
+				&cli.Int64Flag{
+					Name:  "sample-seed",
+					Usage: "Seed of the random sample of --sample",
+				},
+				&cli.BoolFlag{
+					Name:  "stats-only",
+					Usage: "Process all channels & only print aggregate statistics without writing any files",
+				},
+				&cli.BoolFlag{
+					Name:  "stats-json",
+					Usage: "Print the statistics of --dry-run & --stats-only as JSON",
+				},
+				&cli.StringFlag{
+					Name:  "single-file",
+					Usage: "(Optional) Write all channels as a single JSON array to this file instead of one file per channel",
+				},
+				&cli.BoolFlag{
+					Name:  "stdout",
+					Usage: "Print the channels as JSON to stdout, one per line, instead of writing files. Typically combined with --channel-id",
+				},
+				&cli.Uint64Flag{
+					Name:  "channel-timeout",
+					Usage: "(Optional) Channel timeout in L1 blocks. Channels whose frames span more blocks are not ready. Zero disables the check, while reused channel IDs are still detected with the timeout of the chain spec",
+				},
+				&cli.StringSliceFlag{
+					Name:  "channel-id",
+					Usage: "(Optional) Only reassemble the channels with these IDs. May be repeated",
+				},
+			}, oplog.CLIFlags("BATCH_DECODER")...),
 			Action: func(cliCtx *cli.Context) error {
+				logger := oplog.NewLogger(os.Stderr, oplog.ReadCLIConfig(cliCtx))
 				var (
-					L2GenesisTime     uint64         = cliCtx.Uint64("l2-genesis-timestamp")
-					L2BlockTime       uint64         = cliCtx.Uint64("l2-block-time")
-					BatchInboxAddress common.Address = common.HexToAddress(cliCtx.String("inbox"))
+					L2GenesisTime       uint64 = cliCtx.Uint64("l2-genesis-timestamp")
+					L2BlockTime         uint64 = cliCtx.Uint64("l2-block-time")
+					BatchInboxAddresses []common.Address
 				)
+				for _, s := range cliCtx.StringSlice("inbox") {
+					inbox, err := parseAddress("inbox", s)
+					if err != nil {
+						return err
+					}
+					BatchInboxAddresses = append(BatchInboxAddresses, inbox)
+				}
+				senderFilter, err := parseAddress("sender", cliCtx.String("sender"))
+				if err != nil {
+					return err
+				}
 				L2ChainID := new(big.Int).SetUint64(cliCtx.Uint64("l2-chain-id"))
 				rollupCfg, err := rollup.LoadOPStackRollupConfig(L2ChainID.Uint64())
 				if err == nil {
 					// prioritize superchain config
 					if L2GenesisTime != rollupCfg.Genesis.L2Time {
 						L2GenesisTime = rollupCfg.Genesis.L2Time
-						fmt.Printf("L2GenesisTime overridden: %v\n", L2GenesisTime)
+						logger.Info("L2GenesisTime overridden", "l2_genesis_time", L2GenesisTime)
 					}
 					if L2BlockTime != rollupCfg.BlockTime {
 						L2BlockTime = rollupCfg.BlockTime
-						fmt.Printf("L2BlockTime overridden: %v\n", L2BlockTime)
+						logger.Info("L2BlockTime overridden", "l2_block_time", L2BlockTime)
+					}
+					// multiple inboxes are used to analyze inbox rotations, so only a single inbox is overridden
+					if len(BatchInboxAddresses) == 1 && BatchInboxAddresses[0] != rollupCfg.BatchInboxAddress {
+						BatchInboxAddresses[0] = rollupCfg.BatchInboxAddress
+						logger.Info("BatchInboxAddress overridden", "batch_inbox", rollupCfg.BatchInboxAddress)
+					}
+				}
+				inDirectory, inFile, inArchive := cliCtx.String("in"), cliCtx.String("in-file"), cliCtx.String("in-archive")
+				if inFile != "" || inArchive != "" {
+					if inFile != "" && inArchive != "" {
+						return errors.New("--in-file and --in-archive are mutually exclusive")
+					}
+					if cliCtx.IsSet("in") || cliCtx.IsSet("extra-in") {
+						return errors.New("--in & --extra-in are mutually exclusive with --in-file & --in-archive")
+					}
+					inDirectory = ""
+				}
+				var channelIDs []derive.ChannelID
+				for _, s := range cliCtx.StringSlice("channel-id") {
+					var id derive.ChannelID
+					if err := (&id).UnmarshalText([]byte(s)); err != nil {
+						return fmt.Errorf("invalid channel id %q: %w", s, err)
+					}
+					channelIDs = append(channelIDs, id)
+				}
+				var sinceTime, untilTime time.Time
+				if s := cliCtx.String("since"); s != "" {
+					if sinceTime, err = time.Parse(time.RFC3339, s); err != nil {
+						return fmt.Errorf("invalid since time: %w", err)
+					}
+				}
+				if s := cliCtx.String("until"); s != "" {
+					if untilTime, err = time.Parse(time.RFC3339, s); err != nil {
+						return fmt.Errorf("invalid until time: %w", err)
+					}
+				}
+				gasModel, err := reassemble.ParseGasModel(cliCtx.String("gas-model"))
+				if err != nil {
+					return err
+				}
+				var zlibDictionary []byte
+				if file := cliCtx.String("zlib-dictionary"); file != "" {
+					if zlibDictionary, err = os.ReadFile(file); err != nil {
+						return fmt.Errorf("failed to read zlib dictionary: %w", err)
 					}
-					if BatchInboxAddress != rollupCfg.BatchInboxAddress {
-						BatchInboxAddress = rollupCfg.BatchInboxAddress
-						fmt.Printf("BatchInboxAddress overridden: %v\n", BatchInboxAddress)
+				}
+				var maxFrameNumber *uint16
+				if n := cliCtx.Int("max-frame-number"); n >= 0 {
+					if n > math.MaxUint16 {
+						return fmt.Errorf("max frame number %d exceeds the maximum frame number", n)
 					}
+					m := uint16(n)
+					maxFrameNumber = &m
 				}
 				config := reassemble.Config{
-					BatchInbox:    BatchInboxAddress,
-					InDirectory:   cliCtx.String("in"),
-					OutDirectory:  cliCtx.String("out"),
-					L2ChainID:     L2ChainID,
-					L2GenesisTime: L2GenesisTime,
-					L2BlockTime:   L2BlockTime,
-				}
-				reassemble.Channels(config, rollupCfg)
+					BatchInboxes:      BatchInboxAddresses,
+					InDirectory:       inDirectory,
+					InDirectories:     cliCtx.StringSlice("extra-in"),
+					InFile:            inFile,
+					InArchive:         inArchive,
+					OutDirectory:      cliCtx.String("out"),
+					BatchOutDirectory: cliCtx.String("batch-out"),
+					S3: reassemble.S3Config{
+						Endpoint:        cliCtx.String("s3-endpoint"),
+						AccessKeyID:     cliCtx.String("s3-access-key-id"),
+						AccessKeySecret: cliCtx.String("s3-access-key-secret"),
+					},
+					WriteTransactions:     cliCtx.Bool("write-transactions"),
+					WriteBlockFrames:      cliCtx.Bool("write-block-frames"),
+					L2ChainID:             L2ChainID,
+					L2GenesisTime:         L2GenesisTime,
+					L2BlockTime:           L2BlockTime,
+					StartBlock:            cliCtx.Uint64("start"),
+					EndBlock:              cliCtx.Uint64("end"),
+					SinceTime:             sinceTime,
+					UntilTime:             untilTime,
+					Concurrency:           cliCtx.Int("concurrency"),
+					OutputFormat:          cliCtx.String("output-format"),
+					ChannelTimeout:        cliCtx.Uint64("channel-timeout"),
+					Timeline:              cliCtx.Bool("timeline"),
+					DryRun:                cliCtx.Bool("dry-run"),
+					StatsOnly:             cliCtx.Bool("stats-only"),
+					ReadyOnly:             cliCtx.Bool("ready-only"),
+					SampleCount:           cliCtx.Int("sample"),
+					SampleSeed:            cliCtx.Int64("sample-seed"),
+					StrictReady:           cliCtx.Bool("strict-ready"),
+					Timing:                cliCtx.Bool("timing"),
+					ContinueOnError:       cliCtx.Bool("continue-on-error"),
+					SenderFilter:          senderFilter,
+					DumpPayloads:          cliCtx.String("dump-payloads"),
+					Watch:                 cliCtx.Bool("watch"),
+					PrettyPrint:           cliCtx.Bool("pretty"),
+					Replay:                cliCtx.Bool("replay"),
+					StatsJSON:             cliCtx.Bool("stats-json"),
+					SingleFile:            cliCtx.String("single-file"),
+					Stdout:                cliCtx.Bool("stdout"),
+					Resume:                cliCtx.Bool("resume"),
+					SkipEmptyFrames:       cliCtx.Bool("skip-empty-frames"),
+					MaxFrameNumber:        maxFrameNumber,
+					IncludeRawCalldata:    cliCtx.Bool("include-raw-calldata"),
+					HexFrameData:          cliCtx.Bool("hex-frame-data"),
+					GasModel:              gasModel,
+					L1PragueTime:          cliCtx.Uint64("l1-prague-time"),
+					BatchTypesOnly:        cliCtx.Bool("batch-types-only"),
+					LegacyBatches:         cliCtx.Bool("legacy-batches"),
+					VerifyRoundTrip:       cliCtx.Bool("verify-round-trip"),
+					VerifyChecksums:       cliCtx.Bool("verify-checksums"),
+					MaxFramesPerChannel:   cliCtx.Int("max-frames-per-channel"),
+					MaxOutputBytes:        cliCtx.Int64("max-output-bytes"),
+					MaxFrameSize:          cliCtx.Uint64("max-frame-size"),
+					FrameSizeBuckets:      cliCtx.Uint64Slice("frame-size-buckets"),
+					MaxRLPBytesPerChannel: cliCtx.Uint64("max-rlp-bytes-per-channel"),
+					ZlibDictionary:        zlibDictionary,
+					FilenameTemplate:      cliCtx.String("filename-template"),
+					Trace:                 cliCtx.Bool("trace"),
+					SortBy:                cliCtx.String("sort-by"),
+					ChannelIDs:            channelIDs,
+					Log:                   logger,
+				}
+				ctx := ctxinterrupt.WithCancelOnInterrupt(cliCtx.Context)
+				result, err := reassemble.Channels(ctx, config, rollupCfg)
+				if err != nil {
+					log.Fatal(err)
+				}
+				logger.Info("Reassembled channels", "channels", result.Channels, "ready", result.ReadyChannels,
+					"invalid", result.InvalidChannels, "bytes_written", result.BytesWritten)
 				return nil
 			},
 		},
@@ -211,7 +573,14 @@ func main() {
 				if err := (&id).UnmarshalText([]byte(cliCtx.String("id"))); err != nil {
 					log.Fatal(err)
 				}
-				frames := reassemble.LoadFrames(cliCtx.String("in"), common.HexToAddress(cliCtx.String("inbox")))
+				inbox, err := parseAddress("inbox", cliCtx.String("inbox"))
+				if err != nil {
+					return err
+				}
+				frames, err := reassemble.LoadFrames(cliCtx.Context, cliCtx.String("in"), inbox)
+				if err != nil {
+					log.Fatal(err)
+				}
 				var filteredFrames []derive.Frame
 				for _, frame := range frames {
 					if frame.Frame.ID == id {
@@ -232,3 +601,14 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// parseAddress parses the value of the named address flag. An empty value is the zero address.
+func parseAddress(flag, value string) (common.Address, error) {
+	if value == "" {
+		return common.Address{}, nil
+	}
+	if !common.IsHexAddress(value) {
+		return common.Address{}, fmt.Errorf("invalid --%s address %q", flag, value)
+	}
+	return common.HexToAddress(value), nil
+}
@@ -0,0 +1,65 @@
+package reassemble
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
+)
+
+// archiveSource loads the transactions from the InArchive, a tar archive of a fetch output directory,
+// without extracting it. A gzip compressed archive is detected by its magic bytes. Entries which are not
+// valid transaction files are skipped with a warning & counted in the returned error.
+// Checksum files are ignored, as the entries of an archive are not verified.
+type archiveSource struct {
+	config Config
+}
+
+func (s *archiveSource) Load(ctx context.Context, keep func(fetch.TransactionWithMetadata) bool) ([]fetch.TransactionWithMetadata, error) {
+	filename := s.config.InArchive
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := maybeGzipReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %v: %w", filename, err)
+	}
+	tr := tar.NewReader(r)
+	var out []fetch.TransactionWithMetadata
+	malformed := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return out, fmt.Errorf("failed to read %v: %w", filename, err)
+		}
+		if hdr.Typeflag != tar.TypeReg || strings.HasSuffix(hdr.Name, ChecksumSuffix) {
+			continue
+		}
+		txm, err := decodeTransaction(bufio.NewReader(tr), hdr.Name)
+		if err != nil {
+			s.config.logger().Warn("Skipping malformed archive entry", "file", filename, "entry", hdr.Name, "err", err)
+			malformed++
+			continue
+		}
+		if keep(txm) {
+			out = append(out, txm)
+		}
+	}
+	if malformed > 0 {
+		return out, fmt.Errorf("skipped %d malformed entries in %v", malformed, filename)
+	}
+	return out, nil
+}
@@ -0,0 +1,62 @@
+package reassemble
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// BatchSummary describes a single decoded batch. It is written to Config.BatchOutDirectory.
+type BatchSummary struct {
+	ChannelID derive.ChannelID `json:"channel_id"`
+	// Index is the position of the batch inside its channel
+	Index     int `json:"index"`
+	BatchType int `json:"batch_type"`
+	// ParentHash is the parent hash of a singular batch, or the parent hash prefix of the first block
+	// of a span batch
+	ParentHash hexutil.Bytes `json:"parent_hash"`
+	// EpochNum is the epoch of a singular batch, or the epoch of the first block of a span batch
+	EpochNum uint64 `json:"epoch_num"`
+	// EpochHash is only known for singular batches
+	EpochHash        *common.Hash `json:"epoch_hash,omitempty"`
+	Timestamp        uint64       `json:"timestamp"`
+	BlockCount       int          `json:"block_count"`
+	TransactionCount uint64       `json:"transaction_count"`
+}
+
+func newBatchSummary(id derive.ChannelID, index int, batch derive.Batch) BatchSummary {
+	summary := BatchSummary{
+		ChannelID: id,
+		Index:     index,
+		BatchType: batch.GetBatchType(),
+		Timestamp: batch.GetTimestamp(),
+	}
+	if b, ok := batch.AsSingularBatch(); ok {
+		summary.ParentHash = b.ParentHash.Bytes()
+		summary.EpochNum = uint64(b.EpochNum)
+		summary.EpochHash = &b.EpochHash
+		summary.BlockCount = 1
+		summary.TransactionCount = uint64(len(b.Transactions))
+	} else if b, ok := batch.AsSpanBatch(); ok {
+		summary.ParentHash = b.ParentCheck[:]
+		summary.EpochNum = uint64(b.GetStartEpochNum())
+		summary.BlockCount = b.GetBlockCount()
+		summary.TransactionCount = b.TxCount()
+	}
+	return summary
+}
+
+// writeBatchFiles writes a BatchSummary file for each decoded batch of the channel into dir.
+func writeBatchFiles(dir string, perm os.FileMode, pretty bool, ch ChannelWithMetadata) error {
+	for i, batch := range ch.Batches {
+		filename := path.Join(dir, fmt.Sprintf("%s_%d.json", ch.name(), i))
+		if err := writeJSON(filename, perm, pretty, newBatchSummary(ch.ID, i, batch)); err != nil {
+			return fmt.Errorf("failed to write batch %d: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package reassemble
+
+import (
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
+)
+
+// BlockFramesFilename is the name of the file listing the frames included in each L1 block.
+const BlockFramesFilename = "block_frames.json"
+
+// BlockFramesEntry lists the frames included in a single L1 block, in transaction order.
+// It reveals whether the batcher sends the frames of a channel in order or interleaves channels.
+type BlockFramesEntry struct {
+	BlockNumber uint64 `json:"block_number"`
+	// MinFrameNumber & MaxFrameNumber are the lowest & highest frame number included in the block,
+	// regardless of the channel
+	MinFrameNumber uint16             `json:"min_frame_number"`
+	MaxFrameNumber uint16             `json:"max_frame_number"`
+	Frames         []TransactionFrame `json:"frames"`
+}
+
+// blockFramesEntries lists the frames of each inclusion block. The transactions must be sorted by
+// block & transaction index. Blocks without frames are omitted. Only the frame IDs & numbers are
+// listed, so the frames decoded by the fetch command are used without parsing the calldata again.
+func blockFramesEntries(txns []fetch.TransactionWithMetadata) []BlockFramesEntry {
+	entries := []BlockFramesEntry{}
+	for _, tx := range txns {
+		for _, frame := range tx.Frames {
+			number := frame.FrameNumber
+			if n := len(entries); n == 0 || entries[n-1].BlockNumber != tx.BlockNumber {
+				entries = append(entries, BlockFramesEntry{BlockNumber: tx.BlockNumber, MinFrameNumber: number, MaxFrameNumber: number})
+			}
+			entry := &entries[len(entries)-1]
+			entry.MinFrameNumber = min(entry.MinFrameNumber, number)
+			entry.MaxFrameNumber = max(entry.MaxFrameNumber, number)
+			entry.Frames = append(entry.Frames, TransactionFrame{ChannelID: frame.ID, FrameNumber: number})
+		}
+	}
+	return entries
+}
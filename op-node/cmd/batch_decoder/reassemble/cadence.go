@@ -0,0 +1,44 @@
+package reassemble
+
+import (
+	"slices"
+
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
+)
+
+// SubmissionCadence is the distribution of the L1 block gaps between consecutive batcher transactions.
+// Transactions included in the same block have a gap of zero.
+type SubmissionCadence struct {
+	Transactions int     `json:"transactions"`
+	MinGap       uint64  `json:"min_gap"`
+	MaxGap       uint64  `json:"max_gap"`
+	MeanGap      float64 `json:"mean_gap"`
+	MedianGap    float64 `json:"median_gap"`
+}
+
+// submissionCadence computes the cadence of the transactions, which must be sorted by block.
+// Returns nil if there are less than two transactions.
+func submissionCadence(txns []fetch.TransactionWithMetadata) *SubmissionCadence {
+	if len(txns) < 2 {
+		return nil
+	}
+	gaps := make([]uint64, 0, len(txns)-1)
+	var sum uint64
+	for i := 1; i < len(txns); i++ {
+		gap := txns[i].BlockNumber - txns[i-1].BlockNumber
+		gaps = append(gaps, gap)
+		sum += gap
+	}
+	slices.Sort(gaps)
+	median := float64(gaps[len(gaps)/2])
+	if len(gaps)%2 == 0 {
+		median = float64(gaps[len(gaps)/2-1]+gaps[len(gaps)/2]) / 2
+	}
+	return &SubmissionCadence{
+		Transactions: len(txns),
+		MinGap:       gaps[0],
+		MaxGap:       gaps[len(gaps)-1],
+		MeanGap:      float64(sum) / float64(len(gaps)),
+		MedianGap:    median,
+	}
+}
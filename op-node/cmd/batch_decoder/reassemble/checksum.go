@@ -0,0 +1,83 @@
+package reassemble
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ChecksumSuffix is the suffix of the sidecar file holding the SHA-256 checksum of a transaction file.
+// The sidecar holds the hex encoded checksum, optionally followed by the file name as written by sha256sum.
+const ChecksumSuffix = ".sha256"
+
+// ChecksumErrorsFilename is the name of the file listing the input files failing checksum verification.
+const ChecksumErrorsFilename = "checksum_errors.json"
+
+// ChecksumError is returned for an input file which does not match the checksum of its sidecar file.
+type ChecksumError struct {
+	File     string `json:"file"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch of %v: expected %v, got %v", e.File, e.Expected, e.Actual)
+}
+
+// verifyChecksum verifies the file against the checksum of its sidecar file.
+// Files without a sidecar file are not verified.
+func verifyChecksum(file string) error {
+	sidecar, err := os.ReadFile(file + ChecksumSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read checksum of %v: %w", file, err)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return verifyChecksumData(file, sidecar, f)
+}
+
+// verifyChecksumData verifies the data of the file against the checksum held by its sidecar file.
+func verifyChecksumData(file string, sidecar []byte, data io.Reader) error {
+	fields := strings.Fields(string(sidecar))
+	if len(fields) == 0 {
+		return fmt.Errorf("empty checksum file of %v", file)
+	}
+	expected, err := hex.DecodeString(fields[0])
+	if err != nil || len(expected) != sha256.Size {
+		return fmt.Errorf("invalid checksum of %v: %q", file, fields[0])
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, data); err != nil {
+		return fmt.Errorf("failed to hash %v: %w", file, err)
+	}
+	if actual := h.Sum(nil); !bytes.Equal(actual, expected) {
+		return &ChecksumError{File: file, Expected: hex.EncodeToString(expected), Actual: hex.EncodeToString(actual)}
+	}
+	return nil
+}
+
+// checksumErrors collects all checksum errors of the possibly joined error.
+func checksumErrors(err error) []*ChecksumError {
+	out := []*ChecksumError{}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			out = append(out, checksumErrors(e)...)
+		}
+		return out
+	}
+	var checksumErr *ChecksumError
+	if errors.As(err, &checksumErr) {
+		out = append(out, checksumErr)
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package reassemble
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/andybalholm/brotli"
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// CompressionTypeUnknown is the compression type of channels which are not ready or whose
+// compression algorithm is not recognized.
+const CompressionTypeUnknown = "unknown"
+
+// detectCompression detects the compression algorithm of the channel data from its first byte, the
+// same way derive.BatchReader does. Returns an empty algorithm if it is not recognized.
+func detectCompression(data []byte) derive.CompressionAlgo {
+	switch {
+	case len(data) == 0:
+		return ""
+	case data[0]&0x0F == derive.ZlibCM8 || data[0]&0x0F == derive.ZlibCM15:
+		return derive.Zlib
+	case data[0] == derive.ChannelVersionBrotli:
+		return derive.Brotli
+	default:
+		return ""
+	}
+}
+
+// decompressChannel decompresses the channel data, detecting the compression algorithm with
+// detectCompression. Zlib data is decompressed with the preset dictionary if it is not empty.
+// Decompression stops after limit+1 bytes, so that data exceeding the limit is detected without
+// decompressing it fully. The data decompressed before an error is returned alongside it.
+func decompressChannel(data []byte, dict []byte, limit uint64) ([]byte, derive.CompressionAlgo, error) {
+	if len(data) == 0 {
+		return nil, "", errors.New("empty channel data")
+	}
+	var r io.Reader
+	algo := detectCompression(data)
+	switch algo {
+	case derive.Zlib:
+		zr, err := zlib.NewReaderDict(bytes.NewReader(data), dict)
+		if err != nil {
+			return nil, algo, err
+		}
+		r = zr
+	case derive.Brotli:
+		r = brotli.NewReader(bytes.NewReader(data[1:]))
+	default:
+		return nil, "", fmt.Errorf("cannot distinguish the compression algo used given type byte %v", data[0])
+	}
+	out, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	return out, algo, err
+}
+
+// batchReader is derive.BatchReader, except that zlib compressed channels are decompressed with the
+// preset dictionary if it is not empty.
+func batchReader(r io.Reader, maxRLPBytesPerChannel uint64, isFjord bool, dict []byte) (func() (*derive.BatchData, error), error) {
+	if len(dict) == 0 {
+		return derive.BatchReader(r, maxRLPBytesPerChannel, isFjord)
+	}
+	bufReader := bufio.NewReader(r)
+	compressionType, err := bufReader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if detectCompression(compressionType) != derive.Zlib {
+		return derive.BatchReader(bufReader, maxRLPBytesPerChannel, isFjord)
+	}
+	zr, err := zlib.NewReaderDict(bufReader, dict)
+	if err != nil {
+		return nil, err
+	}
+	rlpReader := rlp.NewStream(zr, maxRLPBytesPerChannel)
+	return func() (*derive.BatchData, error) {
+		batchData := derive.BatchData{ComprAlgo: derive.Zlib}
+		if err := rlpReader.Decode(&batchData); err != nil {
+			return nil, err
+		}
+		return &batchData, nil
+	}, nil
+}
+
+// readPayloadBatchTypes returns the distinct batch types of a decompressed channel payload in ascending
+// order. The payload is a sequence of RLP strings which each start with the batch type byte. Only
+// that byte is inspected, the batches themselves are not decoded.
+// The batch types read before an error are returned alongside it.
+func readPayloadBatchTypes(payload []byte) ([]int, error) {
+	var (
+		types []int
+		err   error
+	)
+	for rest := payload; len(rest) > 0; {
+		var content []byte
+		content, rest, err = rlp.SplitString(rest)
+		if err != nil {
+			break
+		}
+		if len(content) == 0 {
+			err = errors.New("empty batch data")
+			break
+		}
+		if !slices.Contains(types, int(content[0])) {
+			types = append(types, int(content[0]))
+		}
+	}
+	slices.Sort(types)
+	return types, err
+}
@@ -0,0 +1,94 @@
+package reassemble
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+)
+
+// ChannelsDiff is the difference between two sets of re-assembled channels, a & b.
+type ChannelsDiff struct {
+	OnlyInA []ChannelRef       `json:"only_in_a"`
+	OnlyInB []ChannelRef       `json:"only_in_b"`
+	Changed []ChannelDiffEntry `json:"changed"`
+}
+
+// ChannelRef identifies a channel by its ID & ChannelWithMetadata.IDReuseIndex, which tells apart
+// the channels of a reused ID.
+type ChannelRef struct {
+	ID           derive.ChannelID `json:"id"`
+	IDReuseIndex int              `json:"id_reuse_index,omitempty"`
+}
+
+// Empty returns true if both sets of channels are equal.
+func (d ChannelsDiff) Empty() bool {
+	return len(d.OnlyInA) == 0 && len(d.OnlyInB) == 0 && len(d.Changed) == 0
+}
+
+// ChannelDiffEntry describes a channel present in both sets which differs between them.
+type ChannelDiffEntry struct {
+	ID           derive.ChannelID `json:"id"`
+	IDReuseIndex int              `json:"id_reuse_index,omitempty"`
+	IsReadyA     bool             `json:"is_ready_a"`
+	IsReadyB     bool             `json:"is_ready_b"`
+	FrameCountA  int              `json:"frame_count_a"`
+	FrameCountB  int              `json:"frame_count_b"`
+	// BatchesDiffer is set if the decoded batches of the channel differ
+	BatchesDiffer bool `json:"batches_differ"`
+}
+
+// DiffChannels compares two sets of re-assembled channels by channel ID & IDReuseIndex. Channels
+// present in both sets are compared by readiness, frame count & decoded batch content. The channels
+// of the diff are in the order of a, followed by the channels only in b in the order of b.
+func DiffChannels(a, b []ChannelWithMetadata) ChannelsDiff {
+	byKey := make(map[channelKey]ChannelWithMetadata, len(b))
+	for _, ch := range b {
+		byKey[channelKey{ch.ID, ch.IDReuseIndex}] = ch
+	}
+	var diff ChannelsDiff
+	seen := make(map[channelKey]struct{}, len(a))
+	for _, chA := range a {
+		key := channelKey{chA.ID, chA.IDReuseIndex}
+		seen[key] = struct{}{}
+		chB, ok := byKey[key]
+		if !ok {
+			diff.OnlyInA = append(diff.OnlyInA, ChannelRef{chA.ID, chA.IDReuseIndex})
+			continue
+		}
+		entry := ChannelDiffEntry{
+			ID:            chA.ID,
+			IDReuseIndex:  chA.IDReuseIndex,
+			IsReadyA:      chA.IsReady,
+			IsReadyB:      chB.IsReady,
+			FrameCountA:   len(chA.Frames),
+			FrameCountB:   len(chB.Frames),
+			BatchesDiffer: !equalBatches(chA.Batches, chB.Batches),
+		}
+		if entry.IsReadyA != entry.IsReadyB || entry.FrameCountA != entry.FrameCountB || entry.BatchesDiffer {
+			diff.Changed = append(diff.Changed, entry)
+		}
+	}
+	for _, chB := range b {
+		if _, ok := seen[channelKey{chB.ID, chB.IDReuseIndex}]; !ok {
+			diff.OnlyInB = append(diff.OnlyInB, ChannelRef{chB.ID, chB.IDReuseIndex})
+		}
+	}
+	return diff
+}
+
+// equalBatches compares the batches by their channel encoding, falling back to their JSON encoding
+// for batches which cannot be re-encoded.
+func equalBatches(a, b []derive.Batch) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	encA, errA := encodeBatches(a)
+	encB, errB := encodeBatches(b)
+	if errA == nil && errB == nil {
+		return bytes.Equal(encA, encB)
+	}
+	jsonA, errA := json.Marshal(a)
+	jsonB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(jsonA, jsonB)
+}
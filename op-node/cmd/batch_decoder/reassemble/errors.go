@@ -0,0 +1,71 @@
+package reassemble
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+)
+
+// ErrorsFilename is the name of the error manifest written to the out directory.
+const ErrorsFilename = "errors.json"
+
+// ErrorManifest lists all channels which are not ready, contain invalid frames or batches or failed
+// a post-processor.
+type ErrorManifest struct {
+	Channels []ChannelErrorEntry `json:"channels"`
+}
+
+// ChannelErrorEntry describes the problems of a single channel.
+type ChannelErrorEntry struct {
+	ID             derive.ChannelID `json:"id"`
+	IDReuseIndex   int              `json:"id_reuse_index,omitempty"`
+	IsReady        bool             `json:"is_ready"`
+	Closed         bool             `json:"closed"`
+	InvalidFrames  bool             `json:"invalid_frames"`
+	InvalidBatches bool             `json:"invalid_batches"`
+	// MissingFrameNumbers are the frame numbers missing up to the highest frame number of the channel
+	MissingFrameNumbers []uint16 `json:"missing_frame_numbers"`
+	SkippedFrameCount   int      `json:"skipped_frame_count"`
+	FirstInclusionBlock uint64   `json:"first_inclusion_block"`
+	PostProcessErrors   []string `json:"post_process_errors,omitempty"`
+	// LikelyTruncatedByWindow marks channels which are likely only incomplete because of the block range
+	LikelyTruncatedByWindow bool `json:"likely_truncated_by_window,omitempty"`
+}
+
+// add records the channel if it is not ready, invalid or failed a post-processor.
+func (m *ErrorManifest) add(ch ChannelWithMetadata) {
+	if ch.IsReady && !ch.InvalidFrames && !ch.InvalidBatches && len(ch.PostProcessErrors) == 0 {
+		return
+	}
+	entry := ChannelErrorEntry{
+		ID:                      ch.ID,
+		IDReuseIndex:            ch.IDReuseIndex,
+		IsReady:                 ch.IsReady,
+		Closed:                  ch.Closed,
+		InvalidFrames:           ch.InvalidFrames,
+		InvalidBatches:          ch.InvalidBatches,
+		MissingFrameNumbers:     ch.MissingFrameNumbers,
+		SkippedFrameCount:       len(ch.SkippedFrames),
+		PostProcessErrors:       ch.PostProcessErrors,
+		LikelyTruncatedByWindow: ch.LikelyTruncatedByWindow,
+	}
+	if len(ch.Frames) > 0 {
+		entry.FirstInclusionBlock = ch.Frames[0].InclusionBlock
+	}
+	m.Channels = append(m.Channels, entry)
+}
+
+// sort orders the entries by first inclusion block, breaking ties by channel ID & reuse index.
+func (m *ErrorManifest) sort() {
+	sort.Slice(m.Channels, func(i, j int) bool {
+		a, b := m.Channels[i], m.Channels[j]
+		if a.FirstInclusionBlock != b.FirstInclusionBlock {
+			return a.FirstInclusionBlock < b.FirstInclusionBlock
+		}
+		if a.ID != b.ID {
+			return bytes.Compare(a.ID[:], b.ID[:]) < 0
+		}
+		return a.IDReuseIndex < b.IDReuseIndex
+	})
+}
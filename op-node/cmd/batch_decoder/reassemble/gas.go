@@ -0,0 +1,89 @@
+package reassemble
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/params"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
+)
+
+// GasModel is the pricing of transaction calldata on L1.
+type GasModel string
+
+const (
+	// GasModelEIP2028 prices calldata at 4 gas per zero byte & 16 gas per non-zero byte
+	GasModelEIP2028 GasModel = "eip2028"
+	// GasModelEIP7623 prices calldata at the floor of 10 gas per token, with a zero byte counting as one
+	// & a non-zero byte as four tokens, introduced with the Prague L1 upgrade. Batcher transactions
+	// carry no execution, so the floor always applies to them.
+	GasModelEIP7623 GasModel = "eip7623"
+)
+
+// txCostFloorPerToken & txTokenPerNonZeroByte are the EIP-7623 calldata cost parameters
+const (
+	txCostFloorPerToken   = 10
+	txTokenPerNonZeroByte = 4
+)
+
+// l1PragueTimes are the Prague activation times of the known L1 chains, by chain ID
+var l1PragueTimes = map[uint64]uint64{
+	1:        1746612311, // mainnet
+	11155111: 1741159776, // sepolia
+	17000:    1740434112, // holesky
+}
+
+// L1PragueTime returns the Prague activation time of the known L1 chain, or zero if it is unknown.
+func L1PragueTime(l1ChainID *big.Int) uint64 {
+	if l1ChainID == nil || !l1ChainID.IsUint64() {
+		return 0
+	}
+	return l1PragueTimes[l1ChainID.Uint64()]
+}
+
+// ParseGasModel parses a GasModel. The empty string selects the model by the inclusion block.
+func ParseGasModel(s string) (GasModel, error) {
+	switch model := GasModel(s); model {
+	case "", GasModelEIP2028, GasModelEIP7623:
+		return model, nil
+	default:
+		return "", fmt.Errorf("unknown gas model: %q", s)
+	}
+}
+
+// gasModel returns the configured GasModel, or the model active on L1 at the block time if none is
+// configured. EIP-7623 is active from the L1PragueTime, if it is known.
+func (c Config) gasModel(blockTime uint64) GasModel {
+	if c.GasModel != "" {
+		return c.GasModel
+	}
+	if c.L1PragueTime != 0 && blockTime >= c.L1PragueTime {
+		return GasModelEIP7623
+	}
+	return GasModelEIP2028
+}
+
+// calldataGas returns the calldata gas of the transaction input under the gas model.
+func (m GasModel) calldataGas(data []byte) uint64 {
+	var zero, nonZero uint64
+	for _, b := range data {
+		if b == 0 {
+			zero++
+		} else {
+			nonZero++
+		}
+	}
+	if m == GasModelEIP7623 {
+		return (zero + nonZero*txTokenPerNonZeroByte) * txCostFloorPerToken
+	}
+	return zero*params.TxDataZeroGas + nonZero*params.TxDataNonZeroGasEIP2028
+}
+
+// withL1PragueTime defaults the L1PragueTime to the activation time of the L1 chain of the rollup config.
+func (c Config) withL1PragueTime(rollupCfg *rollup.Config) Config {
+	if c.L1PragueTime == 0 && rollupCfg != nil {
+		c.L1PragueTime = L1PragueTime(rollupCfg.L1ChainID)
+	}
+	return c
+}
@@ -0,0 +1,123 @@
+package reassemble
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// GraphFilename is the name of the Graphviz DOT file written to the out directory in graph mode.
+const GraphFilename = "channels.dot"
+
+// graphEdge is a frame carried by a transaction into a channel
+type graphEdge struct {
+	tx             common.Hash
+	frameNumber    uint16
+	inclusionBlock uint64
+	skipped        bool
+}
+
+// graphChannel is a channel node & its incoming frame edges
+type graphChannel struct {
+	name                string
+	ready               bool
+	firstInclusionBlock uint64
+	edges               []graphEdge
+}
+
+// graphWriter writes a Graphviz DOT graph of the channels & the transactions which carried their frames
+// to the GraphFilename & the error manifest on Close. Channels & transactions are nodes, frames are
+// edges from their transaction to their channel. Skipped frames are dashed. The graph is written on
+// Close, so that it does not depend on the order in which channels are processed.
+// With readyOnly, channels which are not ready are omitted from the graph.
+type graphWriter struct {
+	dir       string
+	perm      os.FileMode
+	pretty    bool
+	readyOnly bool
+
+	mu       sync.Mutex
+	channels []graphChannel
+	manifest ErrorManifest
+	written  int64
+}
+
+func (w *graphWriter) WriteChannel(ch ChannelWithMetadata) error {
+	skipped := skippedFrameMask(ch)
+	gc := graphChannel{name: ch.name(), ready: ch.IsReady, firstInclusionBlock: ch.FirstInclusionBlock}
+	for i, frame := range ch.Frames {
+		gc.edges = append(gc.edges, graphEdge{
+			tx:             frame.TxHash,
+			frameNumber:    frame.Frame.FrameNumber,
+			inclusionBlock: frame.InclusionBlock,
+			skipped:        skipped[i],
+		})
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.manifest.add(ch)
+	if omitChannel(w.readyOnly, ch) {
+		return nil
+	}
+	w.channels = append(w.channels, gc)
+	return nil
+}
+
+func (w *graphWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	sort.Slice(w.channels, func(i, j int) bool {
+		a, b := w.channels[i], w.channels[j]
+		if a.firstInclusionBlock != b.firstInclusionBlock {
+			return a.firstInclusionBlock < b.firstInclusionBlock
+		}
+		return a.name < b.name
+	})
+	file, err := createFile(path.Join(w.dir, GraphFilename), w.perm)
+	if err != nil {
+		return err
+	}
+	counter := countingWriter{w: file}
+	out := bufio.NewWriter(&counter)
+	fmt.Fprintln(out, "digraph channels {")
+	fmt.Fprintln(out, "  rankdir=LR;")
+	txs := make(map[common.Hash]struct{})
+	for _, ch := range w.channels {
+		color := "red"
+		if ch.ready {
+			color = "green"
+		}
+		fmt.Fprintf(out, "  %q [shape=box, color=%s];\n", "channel "+ch.name, color)
+		for _, edge := range ch.edges {
+			if _, ok := txs[edge.tx]; !ok {
+				txs[edge.tx] = struct{}{}
+				fmt.Fprintf(out, "  %q [shape=ellipse, label=%q];\n", "tx "+edge.tx.String(), edge.tx.TerminalString())
+			}
+			style := "solid"
+			if edge.skipped {
+				style = "dashed"
+			}
+			fmt.Fprintf(out, "  %q -> %q [label=%q, style=%s];\n", "tx "+edge.tx.String(), "channel "+ch.name,
+				fmt.Sprintf("#%d @%d", edge.frameNumber, edge.inclusionBlock), style)
+		}
+	}
+	fmt.Fprintln(out, "}")
+	err = errors.Join(out.Flush(), file.Close())
+	w.written = counter.n
+	if err != nil {
+		return err
+	}
+	return writeErrorManifest(w.dir, w.perm, w.pretty, &w.manifest)
+}
+
+func (w *graphWriter) BytesWritten() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.written
+}
@@ -0,0 +1,44 @@
+package reassemble
+
+import "slices"
+
+// DefaultFrameSizeBuckets are the upper bounds of the frame size histogram buckets used if
+// Config.FrameSizeBuckets is empty.
+var DefaultFrameSizeBuckets = []uint64{1_000, 10_000, 50_000, 100_000, 120_000}
+
+// FrameSizeBucket counts the frames whose data size is in the range [Min, Max].
+type FrameSizeBucket struct {
+	Min uint64 `json:"min"`
+	// Max is nil for the last bucket, which is unbounded
+	Max   *uint64 `json:"max,omitempty"`
+	Count int     `json:"count"`
+}
+
+// frameSizeHistogram buckets the data sizes of the frames by the upper bounds, which are sorted &
+// deduplicated first. A final unbounded bucket counts the frames exceeding all bounds.
+// It returns nil if there are no frames.
+func frameSizeHistogram(bounds []uint64, framesByNumber map[uint16]FrameWithMetadata) []FrameSizeBucket {
+	if len(framesByNumber) == 0 {
+		return nil
+	}
+	if len(bounds) == 0 {
+		bounds = DefaultFrameSizeBuckets
+	}
+	bounds = slices.Clone(bounds)
+	slices.Sort(bounds)
+	bounds = slices.Compact(bounds)
+	out := make([]FrameSizeBucket, len(bounds)+1)
+	for i := range bounds {
+		out[i].Max = &bounds[i]
+		if i > 0 {
+			out[i].Min = bounds[i-1] + 1
+		}
+	}
+	out[len(bounds)].Min = bounds[len(bounds)-1] + 1
+	for _, frame := range framesByNumber {
+		size := uint64(len(frame.Frame.Data))
+		i, _ := slices.BinarySearch(bounds, size)
+		out[i].Count++
+	}
+	return out
+}
@@ -0,0 +1,71 @@
+package reassemble
+
+import (
+	"sort"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+)
+
+// IndexFilename is the name of the index file written to the out directory.
+const IndexFilename = "index.json"
+
+// Index is a manifest of all channels written by a reassemble run.
+type Index struct {
+	// SchemaVersion is the SchemaVersion of the tool which produced the index
+	SchemaVersion string              `json:"schema_version"`
+	Channels      []ChannelIndexEntry `json:"channels"`
+	// Stats aggregates metrics over all channels of the index
+	Stats Stats `json:"stats"`
+}
+
+// ChannelIndexEntry summarizes a single re-assembled channel.
+type ChannelIndexEntry struct {
+	ID derive.ChannelID `json:"id"`
+	// IDReuseIndex distinguishes the channels sharing a reused channel ID
+	IDReuseIndex  int  `json:"id_reuse_index,omitempty"`
+	IsReady       bool `json:"is_ready"`
+	InvalidFrames bool `json:"invalid_frames"`
+	FrameCount    int  `json:"frame_count"`
+	// DataSize is the total size of the frame data of the channel
+	DataSize            uint64 `json:"data_size"`
+	SkippedFrameCount   int    `json:"skipped_frame_count"`
+	FirstInclusionBlock uint64 `json:"first_inclusion_block"`
+	LastInclusionBlock  uint64 `json:"last_inclusion_block"`
+	// Filename of the channel file, relative to the out directory
+	Filename string `json:"filename"`
+}
+
+func newChannelIndexEntry(ch ChannelWithMetadata, filename string) ChannelIndexEntry {
+	entry := ChannelIndexEntry{
+		ID:                ch.ID,
+		IDReuseIndex:      ch.IDReuseIndex,
+		IsReady:           ch.IsReady,
+		InvalidFrames:     ch.InvalidFrames,
+		FrameCount:        len(ch.Frames),
+		DataSize:          framesDataSize(ch.Frames),
+		SkippedFrameCount: len(ch.SkippedFrames),
+		Filename:          filename,
+	}
+	// Frames are sorted in inclusion order
+	if len(ch.Frames) > 0 {
+		entry.FirstInclusionBlock = ch.Frames[0].InclusionBlock
+		entry.LastInclusionBlock = ch.Frames[len(ch.Frames)-1].InclusionBlock
+	}
+	return entry
+}
+
+// sort orders the index entries by the given channelOrder.
+func (idx *Index) sort(less func(a, b channelOrderKey) bool) {
+	sort.Slice(idx.Channels, func(i, j int) bool {
+		return less(idx.Channels[i].orderKey(), idx.Channels[j].orderKey())
+	})
+}
+
+func (e ChannelIndexEntry) orderKey() channelOrderKey {
+	return channelOrderKey{
+		id:         e.ID,
+		firstBlock: e.FirstInclusionBlock,
+		frameCount: e.FrameCount,
+		dataSize:   e.DataSize,
+	}
+}
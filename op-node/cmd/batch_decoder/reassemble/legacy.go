@@ -0,0 +1,163 @@
+package reassemble
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
+)
+
+// LegacyBatchesFilename is the name of the file listing the legacy batches written to the out directory.
+const LegacyBatchesFilename = "legacy_batches.json"
+
+// appendSequencerBatchSelector is the selector of CanonicalTransactionChain.appendSequencerBatch(),
+// which pre-Bedrock sequencers submitted their batches to.
+var appendSequencerBatchSelector = []byte{0xd0, 0xf8, 0x93, 0x44}
+
+// Field sizes of the appendSequencerBatch calldata encoding
+const (
+	legacyStartSize        = 5
+	legacyTotalSize        = 3
+	legacyNumContextsSize  = 3
+	legacyContextSize      = 16
+	legacyTxLenSize        = 3
+	maxLegacyBatchDataSize = 128_000_000
+)
+
+// LegacyBatchContext is a context of a legacy batch, which holds the fields shared by its transactions.
+type LegacyBatchContext struct {
+	NumSequencedTxs       uint64 `json:"num_sequenced_transactions"`
+	NumSubsequentQueueTxs uint64 `json:"num_subsequent_queue_transactions"`
+	Timestamp             uint64 `json:"timestamp"`
+	BlockNumber           uint64 `json:"block_number"`
+}
+
+// LegacyBatch is a pre-Bedrock batch, submitted to the CanonicalTransactionChain by the transaction.
+type LegacyBatch struct {
+	TxHash      common.Hash `json:"transaction_hash"`
+	BlockNumber uint64      `json:"block_number"`
+	// Compressed is true if the transactions of the batch are zlib compressed
+	Compressed            bool                 `json:"compressed"`
+	ShouldStartAtElement  uint64               `json:"should_start_at_element"`
+	TotalElementsToAppend uint64               `json:"total_elements_to_append"`
+	Contexts              []LegacyBatchContext `json:"contexts"`
+	// Transactions are the RLP encoded L2 transactions sequenced by the batch
+	Transactions []hexutil.Bytes `json:"transactions"`
+	// Error is set if the transaction could not be decoded as a legacy batch
+	Error string `json:"error,omitempty"`
+}
+
+// splitLegacyBatches decodes the transactions included before the L1 genesis of the rollup as legacy
+// batches. Transactions which are decoded are removed from txns, while transactions which cannot be
+// decoded are kept, so that their frames are flagged by ProcessFrames. Both are listed in the returned
+// legacy batches, the latter with an error.
+func splitLegacyBatches(txns []fetch.TransactionWithMetadata, rollupCfg *rollup.Config) ([]fetch.TransactionWithMetadata, []LegacyBatch) {
+	var (
+		remaining []fetch.TransactionWithMetadata
+		batches   = []LegacyBatch{}
+	)
+	for _, txm := range txns {
+		if txm.BlockNumber >= rollupCfg.Genesis.L1.Number {
+			remaining = append(remaining, txm)
+			continue
+		}
+		batch, err := decodeLegacyBatch(txm.Tx.Data())
+		batch.TxHash, batch.BlockNumber = txm.Tx.Hash(), txm.BlockNumber
+		if err != nil {
+			batch.Error = err.Error()
+			remaining = append(remaining, txm)
+		}
+		batches = append(batches, batch)
+	}
+	return remaining, batches
+}
+
+// decodeLegacyBatch decodes the calldata of an appendSequencerBatch call. A first context with a zero
+// timestamp marks a typed batch, whose transactions are zlib compressed if the block number is zero.
+func decodeLegacyBatch(data []byte) (LegacyBatch, error) {
+	var batch LegacyBatch
+	if !bytes.HasPrefix(data, appendSequencerBatchSelector) {
+		return batch, errors.New("not an appendSequencerBatch call")
+	}
+	r := bytes.NewReader(data[len(appendSequencerBatchSelector):])
+	var (
+		numContexts uint64
+		err         error
+	)
+	if batch.ShouldStartAtElement, err = readLegacyUint(r, legacyStartSize); err != nil {
+		return batch, err
+	}
+	if batch.TotalElementsToAppend, err = readLegacyUint(r, legacyTotalSize); err != nil {
+		return batch, err
+	}
+	if numContexts, err = readLegacyUint(r, legacyNumContextsSize); err != nil {
+		return batch, err
+	}
+	if numContexts*legacyContextSize > uint64(r.Len()) {
+		return batch, fmt.Errorf("%d contexts exceed the calldata", numContexts)
+	}
+	batch.Contexts = make([]LegacyBatchContext, numContexts)
+	for i := range batch.Contexts {
+		ctx := &batch.Contexts[i]
+		// The calldata is known to hold all contexts, so reading them cannot fail
+		ctx.NumSequencedTxs, _ = readLegacyUint(r, 3)
+		ctx.NumSubsequentQueueTxs, _ = readLegacyUint(r, 3)
+		ctx.Timestamp, _ = readLegacyUint(r, 5)
+		ctx.BlockNumber, _ = readLegacyUint(r, 5)
+	}
+
+	var txs io.Reader = r
+	if len(batch.Contexts) > 0 && batch.Contexts[0].Timestamp == 0 {
+		if batchType := batch.Contexts[0].BlockNumber; batchType != 0 {
+			return batch, fmt.Errorf("unknown legacy batch type %d", batchType)
+		}
+		batch.Compressed = true
+		batch.Contexts = batch.Contexts[1:]
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return batch, fmt.Errorf("invalid compressed transactions: %w", err)
+		}
+		defer zr.Close()
+		// Decompression is bounded, larger data fails the transaction count check
+		txs = io.LimitReader(zr, maxLegacyBatchDataSize)
+	}
+	var sequenced uint64
+	for _, ctx := range batch.Contexts {
+		sequenced += ctx.NumSequencedTxs
+	}
+	for {
+		size, err := readLegacyUint(txs, legacyTxLenSize)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return batch, fmt.Errorf("invalid transaction length: %w", err)
+		}
+		tx := make([]byte, size)
+		if _, err := io.ReadFull(txs, tx); err != nil {
+			return batch, fmt.Errorf("truncated transaction %d: %w", len(batch.Transactions), err)
+		}
+		batch.Transactions = append(batch.Transactions, tx)
+	}
+	if uint64(len(batch.Transactions)) != sequenced {
+		return batch, fmt.Errorf("contexts sequence %d transactions, but the batch holds %d", sequenced, len(batch.Transactions))
+	}
+	return batch, nil
+}
+
+// readLegacyUint reads a big endian integer of the given size. It returns io.EOF only if no byte is
+// left to read.
+func readLegacyUint(r io.Reader, size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[8-size:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
@@ -0,0 +1,395 @@
+package reassemble
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TransactionSource provides the batcher transactions to reassemble.
+type TransactionSource interface {
+	// Load returns the transactions of the source for which keep returns true. Keep is called as soon
+	// as a transaction is decoded, so that transactions which are not kept are never retained.
+	// Transactions which fail to load may be skipped & reported in the returned error, alongside the
+	// transactions which did load.
+	Load(ctx context.Context, keep func(fetch.TransactionWithMetadata) bool) ([]fetch.TransactionWithMetadata, error)
+}
+
+// TransactionSlice is an in-memory TransactionSource.
+type TransactionSlice []fetch.TransactionWithMetadata
+
+func (s TransactionSlice) Load(ctx context.Context, keep func(fetch.TransactionWithMetadata) bool) ([]fetch.TransactionWithMetadata, error) {
+	var out []fetch.TransactionWithMetadata
+	for _, txm := range s {
+		if keep(txm) {
+			out = append(out, txm)
+		}
+	}
+	return out, ctx.Err()
+}
+
+// transactionSource returns the configured source, which is either the Source, the InDirectory &
+// InDirectories with one transaction file per transaction, the newline delimited InFile or the
+// tar InArchive. An s3://bucket/prefix InDirectory is loaded from the S3-compatible object store
+// configured by Config.S3.
+func (c Config) transactionSource() (TransactionSource, error) {
+	inputs := 0
+	for _, set := range []bool{c.Source != nil, c.InFile != "", c.InArchive != "", len(c.inDirectories()) > 0} {
+		if set {
+			inputs++
+		}
+	}
+	if inputs > 1 {
+		return nil, errors.New("source, input file, input archive & input directory are mutually exclusive")
+	}
+	switch {
+	case c.Source != nil:
+		return c.Source, nil
+	case c.InFile != "":
+		return &ndjsonSource{config: c}, nil
+	case c.InArchive != "":
+		return &archiveSource{config: c}, nil
+	}
+	dirs := c.inDirectories()
+	if len(dirs) == 1 {
+		return c.directorySource(dirs[0])
+	}
+	var sources []TransactionSource
+	for _, dir := range dirs {
+		source, err := c.directorySource(dir)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	return multiSource(sources), nil
+}
+
+// inDirectories returns the InDirectory followed by the InDirectories.
+func (c Config) inDirectories() []string {
+	var dirs []string
+	if c.InDirectory != "" {
+		dirs = append(dirs, c.InDirectory)
+	}
+	return append(dirs, c.InDirectories...)
+}
+
+// directorySource returns the source of a single local or s3://bucket/prefix input directory.
+func (c Config) directorySource(dir string) (TransactionSource, error) {
+	if bucket, prefix, ok, err := parseS3URL(dir); err != nil {
+		return nil, err
+	} else if ok {
+		store, err := newS3Store(c.S3, bucket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create s3 client: %w", err)
+		}
+		return &ObjectStoreSource{Store: store, Prefix: prefix, VerifyChecksums: c.VerifyChecksums, ProgressFunc: c.progress}, nil
+	}
+	c.InDirectory = dir
+	return &directorySource{config: c}, nil
+}
+
+// multiSource loads the transactions of all sources in order. A transaction present in several
+// sources, e.g. in overlapping partitions of the fetch output, is only loaded once. Each source
+// applies keep before the duplicates are removed.
+type multiSource []TransactionSource
+
+func (s multiSource) Load(ctx context.Context, keep func(fetch.TransactionWithMetadata) bool) ([]fetch.TransactionWithMetadata, error) {
+	var (
+		out  []fetch.TransactionWithMetadata
+		errs error
+		seen = make(map[common.Hash]struct{})
+	)
+	for _, source := range s {
+		txns, err := source.Load(ctx, keep)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		errs = errors.Join(errs, err)
+		for _, txm := range txns {
+			hash := txm.Tx.Hash()
+			if _, ok := seen[hash]; ok {
+				continue
+			}
+			seen[hash] = struct{}{}
+			out = append(out, txm)
+		}
+	}
+	return out, errs
+}
+
+// loadTransactions loads the transactions from the configured source & filters them by the
+// inbox, block range & time window of the config.
+// Files which fail to load are skipped and their errors are joined into the returned error.
+func loadTransactions(ctx context.Context, config Config) ([]fetch.TransactionWithMetadata, error) {
+	source, err := config.transactionSource()
+	if err != nil {
+		return nil, err
+	}
+	filter := transactionFilter{config: config}
+	txns, err := source.Load(ctx, filter.keep)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	filter.report()
+	return txns, err
+}
+
+// directorySource loads the transactions from the InDirectory, which holds one file per transaction.
+type directorySource struct {
+	config Config
+}
+
+func (s *directorySource) Load(ctx context.Context, keep func(fetch.TransactionWithMetadata) bool) ([]fetch.TransactionWithMetadata, error) {
+	files, err := os.ReadDir(s.config.InDirectory)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		out  []fetch.TransactionWithMetadata
+		errs error
+	)
+	for i, file := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(file.Name(), ChecksumSuffix) {
+			continue
+		}
+		f := path.Join(s.config.InDirectory, file.Name())
+		if s.config.VerifyChecksums {
+			if err := verifyChecksum(f); err != nil {
+				s.config.progress(i+1, len(files))
+				errs = errors.Join(errs, err)
+				continue
+			}
+		}
+		txm, err := loadTransactionsFile(f)
+		s.config.progress(i+1, len(files))
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		if keep(txm) {
+			out = append(out, txm)
+		}
+	}
+	return out, errs
+}
+
+// ndjsonSource loads the transactions from the InFile, which holds one JSON encoded transaction per line.
+// Malformed lines are skipped & counted in the returned error.
+type ndjsonSource struct {
+	config Config
+}
+
+func (s *ndjsonSource) Load(ctx context.Context, keep func(fetch.TransactionWithMetadata) bool) ([]fetch.TransactionWithMetadata, error) {
+	filename := s.config.InFile
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := maybeGzipReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %v: %w", filename, err)
+	}
+	// Lines are read individually so that decoding can resume after a malformed line
+	br := bufio.NewReader(r)
+	var out []fetch.TransactionWithMetadata
+	malformed := 0
+	for lineNumber := 1; ; lineNumber++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return out, fmt.Errorf("failed to read %v: %w", filename, err)
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			var txm fetch.TransactionWithMetadata
+			if decodeErr := json.Unmarshal(line, &txm); decodeErr != nil {
+				s.config.logger().Warn("Skipping malformed transaction", "file", filename, "line", lineNumber, "err", decodeErr)
+				malformed++
+			} else if keep(txm) {
+				out = append(out, txm)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if malformed > 0 {
+		return out, fmt.Errorf("skipped %d malformed lines in %v", malformed, filename)
+	}
+	return out, nil
+}
+
+// transactionFilter keeps the loaded transactions which match the inbox, block range & time
+// window of the config & counts the others. Transactions of invalid senders are kept, see
+// splitRejectedSenders.
+type transactionFilter struct {
+	config       Config
+	outOfRange   int
+	outOfWindow  int
+	missingTimes int
+	otherSenders int
+}
+
+func (f *transactionFilter) keep(txm fetch.TransactionWithMetadata) bool {
+	if !f.config.inBlockRange(txm.BlockNumber) {
+		f.outOfRange++
+		return false
+	}
+	if f.config.hasTimeWindow() {
+		if txm.BlockTime == 0 {
+			f.missingTimes++
+		} else if !f.config.inTimeWindow(time.Unix(int64(txm.BlockTime), 0)) {
+			f.outOfWindow++
+			return false
+		}
+	}
+	if f.config.SenderFilter != (common.Address{}) && txm.Sender != f.config.SenderFilter {
+		f.otherSenders++
+		return false
+	}
+	return f.config.matchesInbox(txm.InboxAddr)
+}
+
+// report logs the number of transactions which were not kept.
+func (f *transactionFilter) report() {
+	if f.outOfRange > 0 {
+		f.config.logger().Debug("Skipped transactions outside of block range", "count", f.outOfRange,
+			"start_block", f.config.StartBlock, "end_block", f.config.EndBlock)
+	}
+	if f.outOfWindow > 0 {
+		f.config.logger().Debug("Skipped transactions outside of time window", "count", f.outOfWindow,
+			"since", f.config.SinceTime, "until", f.config.UntilTime)
+	}
+	if f.otherSenders > 0 {
+		f.config.logger().Debug("Skipped transactions of other senders", "count", f.otherSenders,
+			"sender", f.config.SenderFilter)
+	}
+	if f.missingTimes > 0 {
+		f.config.logger().Warn("Time window not applied to transactions without block time", "count", f.missingTimes)
+	}
+}
+
+// RejectedSendersFilename is the name of the file listing the transactions of invalid senders.
+const RejectedSendersFilename = "rejected_senders.json"
+
+// RejectedTransaction is a transaction which was ignored because it was not sent by a valid batcher.
+type RejectedTransaction struct {
+	TxHash      common.Hash    `json:"transaction_hash"`
+	BlockNumber uint64         `json:"block_number"`
+	Sender      common.Address `json:"sender"`
+	InboxAddr   common.Address `json:"inbox_address"`
+}
+
+// splitRejectedSenders separates the transactions of invalid senders from the valid transactions.
+// The rejected transactions are never nil, so that they are written as an empty JSON array.
+func splitRejectedSenders(txns []fetch.TransactionWithMetadata) ([]fetch.TransactionWithMetadata, []RejectedTransaction) {
+	var valid []fetch.TransactionWithMetadata
+	rejected := []RejectedTransaction{}
+	for _, txm := range txns {
+		if txm.ValidSender {
+			valid = append(valid, txm)
+			continue
+		}
+		rejected = append(rejected, RejectedTransaction{
+			TxHash:      txm.Tx.Hash(),
+			BlockNumber: txm.BlockNumber,
+			Sender:      txm.Sender,
+			InboxAddr:   txm.InboxAddr,
+		})
+	}
+	return valid, rejected
+}
+
+// matchesInbox returns true if transactions to the inbox address should be loaded.
+func (c Config) matchesInbox(inbox common.Address) bool {
+	if len(c.BatchInboxes) == 0 {
+		return true
+	}
+	for _, addr := range c.BatchInboxes {
+		if addr == (common.Address{}) || addr == inbox {
+			return true
+		}
+	}
+	return false
+}
+
+// inBlockRange returns true if the block number is within [StartBlock, EndBlock].
+func (c Config) inBlockRange(number uint64) bool {
+	if c.StartBlock != 0 && number < c.StartBlock {
+		return false
+	}
+	if c.EndBlock != 0 && number > c.EndBlock {
+		return false
+	}
+	return true
+}
+
+func (c Config) hasTimeWindow() bool {
+	return !c.SinceTime.IsZero() || !c.UntilTime.IsZero()
+}
+
+// inTimeWindow returns true if t is within [SinceTime, UntilTime].
+func (c Config) inTimeWindow(t time.Time) bool {
+	if !c.SinceTime.IsZero() && t.Before(c.SinceTime) {
+		return false
+	}
+	if !c.UntilTime.IsZero() && t.After(c.UntilTime) {
+		return false
+	}
+	return true
+}
+
+// loadTransactionsFile decodes a single transaction file.
+// Gzip compressed files are detected by their magic bytes and transparently decompressed.
+func loadTransactionsFile(file string) (fetch.TransactionWithMetadata, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return fetch.TransactionWithMetadata{}, err
+	}
+	defer f.Close()
+	return decodeTransaction(bufio.NewReader(f), file)
+}
+
+// decodeTransaction decodes a single, optionally gzip compressed, transaction file.
+func decodeTransaction(br *bufio.Reader, name string) (fetch.TransactionWithMetadata, error) {
+	r, err := maybeGzipReader(br)
+	if err != nil {
+		return fetch.TransactionWithMetadata{}, fmt.Errorf("failed to open %v: %w", name, err)
+	}
+	dec := json.NewDecoder(r)
+	var txm fetch.TransactionWithMetadata
+	if err := dec.Decode(&txm); err != nil {
+		return fetch.TransactionWithMetadata{}, fmt.Errorf("failed to decode %v: %w", name, err)
+	}
+	return txm, nil
+}
+
+// maybeGzipReader wraps r in a gzip reader if the data starts with the gzip magic bytes.
+func maybeGzipReader(r *bufio.Reader) (io.Reader, error) {
+	magic, err := r.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return gzip.NewReader(r)
+	}
+	return r, nil
+}
@@ -0,0 +1,75 @@
+package reassemble
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	opmetrics "github.com/ethereum-optimism/optimism/op-service/metrics"
+)
+
+// MetricsNamespace is the namespace of the reassemble metrics.
+const MetricsNamespace = "batch_decoder"
+
+// Metricer records metrics of processed channels. Implementations must be safe for concurrent use.
+type Metricer interface {
+	RecordChannel(ch ChannelWithMetadata)
+}
+
+// Metrics counts processed channels, frames & bytes as Prometheus counters.
+type Metrics struct {
+	ChannelsProcessed prometheus.Counter
+	ChannelsReady     prometheus.Counter
+	ChannelsInvalid   prometheus.Counter
+	FramesSkipped     prometheus.Counter
+	BytesDecompressed prometheus.Counter
+}
+
+var _ Metricer = (*Metrics)(nil)
+
+// NewMetrics creates the reassemble metrics & registers them with the registry. The metrics can be
+// shared between multiple runs, so the registry only has to be set up once by long-running callers.
+func NewMetrics(registry *prometheus.Registry) *Metrics {
+	factory := opmetrics.With(registry)
+	return &Metrics{
+		ChannelsProcessed: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "channels_processed",
+			Help:      "Number of processed channels",
+		}),
+		ChannelsReady: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "channels_ready",
+			Help:      "Number of processed channels which are ready",
+		}),
+		ChannelsInvalid: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "channels_invalid",
+			Help:      "Number of processed channels with invalid frames or batches",
+		}),
+		FramesSkipped: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "frames_skipped",
+			Help:      "Number of frames skipped while re-assembling channels",
+		}),
+		BytesDecompressed: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "bytes_decompressed",
+			Help:      "Number of decompressed channel bytes",
+		}),
+	}
+}
+
+func (m *Metrics) RecordChannel(ch ChannelWithMetadata) {
+	m.ChannelsProcessed.Inc()
+	if ch.IsReady {
+		m.ChannelsReady.Inc()
+	}
+	if ch.InvalidFrames || ch.InvalidBatches {
+		m.ChannelsInvalid.Inc()
+	}
+	m.FramesSkipped.Add(float64(len(ch.SkippedFrames)))
+	m.BytesDecompressed.Add(float64(ch.DecompressedSize))
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) RecordChannel(ChannelWithMetadata) {}
@@ -0,0 +1,64 @@
+package reassemble
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// NonceGap is a range of nonces missing between two loaded transactions of the same batcher.
+// A gap hints at a dropped or stuck batcher transaction.
+type NonceGap struct {
+	Sender common.Address `json:"sender"`
+	// FirstMissing & LastMissing are the first & last missing nonce (both inclusive)
+	FirstMissing uint64 `json:"first_missing"`
+	LastMissing  uint64 `json:"last_missing"`
+	// BlockBefore & BlockAfter are the inclusion blocks of the transactions surrounding the gap
+	BlockBefore uint64 `json:"block_before"`
+	BlockAfter  uint64 `json:"block_after"`
+}
+
+// nonceGaps detects gaps in the nonces of the transactions of each sender.
+// The gaps are ordered by sender, then nonce.
+func nonceGaps(txns []fetch.TransactionWithMetadata) []NonceGap {
+	type sent struct {
+		nonce uint64
+		block uint64
+	}
+	bySender := make(map[common.Address][]sent)
+	for _, tx := range txns {
+		bySender[tx.Sender] = append(bySender[tx.Sender], sent{tx.Tx.Nonce(), tx.BlockNumber})
+	}
+	senders := make([]common.Address, 0, len(bySender))
+	for sender := range bySender {
+		senders = append(senders, sender)
+	}
+	sort.Slice(senders, func(i, j int) bool {
+		return bytes.Compare(senders[i][:], senders[j][:]) < 0
+	})
+	var gaps []NonceGap
+	for _, sender := range senders {
+		txs := bySender[sender]
+		// Replacement transactions share a nonce. The last included one surrounds the gap.
+		sort.Slice(txs, func(i, j int) bool {
+			if txs[i].nonce != txs[j].nonce {
+				return txs[i].nonce < txs[j].nonce
+			}
+			return txs[i].block < txs[j].block
+		})
+		for i := 1; i < len(txs); i++ {
+			if prev, next := txs[i-1], txs[i]; next.nonce > prev.nonce+1 {
+				gaps = append(gaps, NonceGap{
+					Sender:       sender,
+					FirstMissing: prev.nonce + 1,
+					LastMissing:  next.nonce - 1,
+					BlockBefore:  prev.block,
+					BlockAfter:   next.block,
+				})
+			}
+		}
+	}
+	return gaps
+}
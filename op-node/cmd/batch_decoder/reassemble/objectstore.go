@@ -0,0 +1,135 @@
+package reassemble
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
+)
+
+// ObjectStore provides the transaction files of an object store, e.g. S3.
+type ObjectStore interface {
+	// List returns the keys of all objects with the given prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Get opens the object with the given key.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// ObjectStoreSource loads the transactions from an ObjectStore, which holds one transaction file
+// per object below the Prefix, like the InDirectory. Objects are streamed one at a time.
+type ObjectStoreSource struct {
+	Store  ObjectStore
+	Prefix string
+	// VerifyChecksums verifies each object against the checksum of its sidecar object, like
+	// Config.VerifyChecksums. Verified objects are read into memory before they are decoded.
+	VerifyChecksums bool
+	// ProgressFunc is called after each object is loaded, like Config.ProgressFunc. Optional.
+	ProgressFunc func(done, total int)
+}
+
+func (s *ObjectStoreSource) Load(ctx context.Context, keep func(fetch.TransactionWithMetadata) bool) ([]fetch.TransactionWithMetadata, error) {
+	keys, err := s.Store.List(ctx, s.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	checksums := make(map[string]bool)
+	for _, key := range keys {
+		if strings.HasSuffix(key, ChecksumSuffix) {
+			checksums[strings.TrimSuffix(key, ChecksumSuffix)] = true
+		}
+	}
+	var (
+		out  []fetch.TransactionWithMetadata
+		errs error
+	)
+	for i, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(key, ChecksumSuffix) {
+			continue
+		}
+		txm, err := s.load(ctx, key, s.VerifyChecksums && checksums[key])
+		if s.ProgressFunc != nil {
+			s.ProgressFunc(i+1, len(keys))
+		}
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		if keep(txm) {
+			out = append(out, txm)
+		}
+	}
+	return out, errs
+}
+
+// load decodes the transaction of the object. With verify, the object is verified against the
+// checksum of its sidecar object first.
+func (s *ObjectStoreSource) load(ctx context.Context, key string, verify bool) (fetch.TransactionWithMetadata, error) {
+	if !verify {
+		obj, err := s.Store.Get(ctx, key)
+		if err != nil {
+			return fetch.TransactionWithMetadata{}, fmt.Errorf("failed to get %v: %w", key, err)
+		}
+		defer obj.Close()
+		return decodeTransaction(bufio.NewReader(obj), key)
+	}
+	data, err := s.get(ctx, key)
+	if err != nil {
+		return fetch.TransactionWithMetadata{}, err
+	}
+	sidecar, err := s.get(ctx, key+ChecksumSuffix)
+	if err != nil {
+		return fetch.TransactionWithMetadata{}, err
+	}
+	if err := verifyChecksumData(key, sidecar, bytes.NewReader(data)); err != nil {
+		return fetch.TransactionWithMetadata{}, err
+	}
+	return decodeTransaction(bufio.NewReader(bytes.NewReader(data)), key)
+}
+
+// get reads the whole object.
+func (s *ObjectStoreSource) get(ctx context.Context, key string) ([]byte, error) {
+	obj, err := s.Store.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %v: %w", key, err)
+	}
+	defer obj.Close()
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %v: %w", key, err)
+	}
+	return data, nil
+}
+
+// S3Config configures the S3-compatible object store of an s3:// InDirectory.
+type S3Config struct {
+	Endpoint        string
+	AccessKeyID     string
+	AccessKeySecret string
+	// Insecure disables TLS, e.g. for a local test deployment
+	Insecure bool
+}
+
+// parseS3URL splits an s3://bucket/prefix URL into the bucket & prefix.
+// It returns false if the location is no s3:// URL.
+func parseS3URL(location string) (bucket string, prefix string, ok bool, err error) {
+	if !strings.HasPrefix(location, "s3://") {
+		return "", "", false, nil
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", "", true, fmt.Errorf("invalid s3 url %q: %w", location, err)
+	}
+	if u.Host == "" {
+		return "", "", true, fmt.Errorf("missing bucket in s3 url %q", location)
+	}
+	return u.Host, strings.TrimPrefix(u.Path, "/"), true, nil
+}
@@ -0,0 +1,64 @@
+package reassemble
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+)
+
+const (
+	// SortByBlock orders channels by their first inclusion block
+	SortByBlock = "block"
+	// SortByFrameCount orders channels by descending number of frames
+	SortByFrameCount = "frame_count"
+	// SortByDataSize orders channels by descending size of their frame data
+	SortByDataSize = "data_size"
+)
+
+// channelOrderKey holds the properties channels are ordered by.
+type channelOrderKey struct {
+	id         derive.ChannelID
+	firstBlock uint64
+	frameCount int
+	dataSize   uint64
+}
+
+// channelOrder returns the ordering of Config.SortBy. Ties are broken by first inclusion block,
+// then channel ID, so that the order is reproducible between runs.
+func channelOrder(sortBy string) (func(a, b channelOrderKey) bool, error) {
+	byBlock := func(a, b channelOrderKey) bool {
+		if a.firstBlock != b.firstBlock {
+			return a.firstBlock < b.firstBlock
+		}
+		return bytes.Compare(a.id[:], b.id[:]) < 0
+	}
+	switch sortBy {
+	case "", SortByBlock:
+		return byBlock, nil
+	case SortByFrameCount:
+		return func(a, b channelOrderKey) bool {
+			if a.frameCount != b.frameCount {
+				return a.frameCount > b.frameCount
+			}
+			return byBlock(a, b)
+		}, nil
+	case SortByDataSize:
+		return func(a, b channelOrderKey) bool {
+			if a.dataSize != b.dataSize {
+				return a.dataSize > b.dataSize
+			}
+			return byBlock(a, b)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown sort order: %q", sortBy)
+	}
+}
+
+func framesDataSize(frames []FrameWithMetadata) uint64 {
+	var size uint64
+	for _, frame := range frames {
+		size += uint64(frame.DataLen)
+	}
+	return size
+}
@@ -0,0 +1,638 @@
+package reassemble
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// OutputFormatJSON writes one JSON file per channel & an index file
+	OutputFormatJSON = "json"
+	// OutputFormatCSV writes the metadata of all frames into a single CSV file
+	OutputFormatCSV = "csv"
+	// OutputFormatNDJSON writes one JSON encoded channel per line to Config.Output, the SingleFile or stdout
+	OutputFormatNDJSON = "ndjson"
+	// OutputFormatParquet writes the metadata of all frames & channels into two parquet tables.
+	// It is only available in builds with the parquet,purego build tags.
+	OutputFormatParquet = "parquet"
+	// OutputFormatGraph writes a Graphviz DOT graph connecting the channels & the transactions carrying their frames
+	OutputFormatGraph = "graph"
+)
+
+// FramesCSVFilename is the name of the file written to the out directory in CSV mode.
+const FramesCSVFilename = "frames.csv"
+
+// ErrOutputLimit is returned by Channels when writing a channel would exceed Config.MaxOutputBytes.
+var ErrOutputLimit = errors.New("output size limit reached")
+
+// outputBudget tracks the bytes written against Config.MaxOutputBytes. It is safe for concurrent use.
+// Writers reserve the bytes of each channel after encoding & before writing it. A nil budget is unlimited.
+type outputBudget struct {
+	limit int64
+
+	mu       sync.Mutex
+	written  int64
+	channels int
+	exceeded bool
+}
+
+// reserve accounts for the size of a channel & returns true if it fits into the remaining budget.
+// Once a channel does not fit, no further channels are accepted.
+func (b *outputBudget) reserve(size int) bool {
+	if b == nil || b.limit <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.exceeded || b.written+int64(size) > b.limit {
+		b.exceeded = true
+		return false
+	}
+	b.written += int64(size)
+	b.channels++
+	return true
+}
+
+// channelWriter persists re-assembled channels. Implementations must be safe for concurrent use.
+type channelWriter interface {
+	WriteChannel(ch ChannelWithMetadata) error
+	// Close finishes the output. It is called once all channels are written.
+	Close() error
+	// BytesWritten is the size of the channel output written so far. It is complete after Close.
+	BytesWritten() int64
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// newChannelWriter creates the writer of the configured output. The statistics of writers which
+// aggregate them start from stats, e.g. to include the nonce gaps of the loaded transactions.
+// The JSON & NDJSON writers return ErrOutputLimit for channels which do not fit into the budget.
+func newChannelWriter(config Config, stats Stats, budget *outputBudget) (channelWriter, error) {
+	if config.statsOnly() {
+		return &statsWriter{out: config.output(), json: config.StatsJSON, pretty: config.PrettyPrint, stats: stats}, nil
+	}
+	if config.Stdout {
+		if config.OutputFormat != "" && config.OutputFormat != OutputFormatJSON && config.OutputFormat != OutputFormatNDJSON {
+			return nil, errors.New("stdout output requires the json or ndjson output format")
+		}
+		if config.SingleFile != "" {
+			return nil, errors.New("stdout output is exclusive with single file output")
+		}
+		return newNDJSONWriter(config.output(), nil, config.ReadyOnly, budget), nil
+	}
+	if config.MaxOutputBytes > 0 && config.OutputFormat != "" && config.OutputFormat != OutputFormatJSON &&
+		config.OutputFormat != OutputFormatNDJSON {
+		return nil, errors.New("max output bytes requires the json or ndjson output format")
+	}
+	switch config.OutputFormat {
+	case "", OutputFormatJSON:
+		if config.SingleFile != "" {
+			return newArrayWriter(config.SingleFile, config.filePerm(), config.PrettyPrint, config.ReadyOnly, budget)
+		}
+		filenames, err := newFilenameTemplate(config.FilenameTemplate)
+		if err != nil {
+			return nil, err
+		}
+		order, err := channelOrder(config.SortBy)
+		if err != nil {
+			return nil, err
+		}
+		return &directoryWriter{dir: config.OutDirectory, perm: config.filePerm(), dirPerm: config.dirPerm(),
+			pretty: config.PrettyPrint, filenames: filenames, order: order, resume: config.Resume, readyOnly: config.ReadyOnly,
+			log: config.logger(), budget: budget, index: Index{Stats: stats}}, nil
+	case OutputFormatNDJSON:
+		if config.Output != nil {
+			return newNDJSONWriter(config.Output, nil, config.ReadyOnly, budget), nil
+		}
+		if config.SingleFile != "" {
+			file, err := createFile(config.SingleFile, config.filePerm())
+			if err != nil {
+				return nil, err
+			}
+			return newNDJSONWriter(file, file, config.ReadyOnly, budget), nil
+		}
+		return newNDJSONWriter(config.output(), nil, config.ReadyOnly, budget), nil
+	case OutputFormatCSV:
+		if config.SingleFile != "" {
+			return nil, errors.New("single file output requires the json output format")
+		}
+		return newCSVWriter(config.OutDirectory, config.filePerm(), config.PrettyPrint, config.ReadyOnly)
+	case OutputFormatParquet:
+		if config.SingleFile != "" {
+			return nil, errors.New("single file output requires the json output format")
+		}
+		return newParquetWriter(config.OutDirectory, config.filePerm(), config.PrettyPrint, config.ReadyOnly)
+	case OutputFormatGraph:
+		if config.SingleFile != "" {
+			return nil, errors.New("single file output requires the json output format")
+		}
+		return &graphWriter{dir: config.OutDirectory, perm: config.filePerm(), pretty: config.PrettyPrint, readyOnly: config.ReadyOnly}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format: %q", config.OutputFormat)
+	}
+}
+
+// directoryWriter writes each channel to its own JSON file & an index of all channels and the
+// error manifest on Close. With readyOnly, channels which are not ready are only counted in the
+// statistics & listed in the error manifest.
+type directoryWriter struct {
+	dir       string
+	perm      os.FileMode
+	dirPerm   os.FileMode
+	pretty    bool
+	filenames *template.Template
+	order     func(a, b channelOrderKey) bool
+	resume    bool
+	readyOnly bool
+	log       log.Logger
+	budget    *outputBudget
+
+	mu       sync.Mutex
+	index    Index
+	manifest ErrorManifest
+	resumed  int
+	written  int64
+	// used maps the rendered filenames to the name of the channel written to them
+	used map[string]string
+}
+
+func (w *directoryWriter) WriteChannel(ch ChannelWithMetadata) error {
+	if omitChannel(w.readyOnly, ch) {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.index.Stats.add(ch)
+		w.manifest.add(ch)
+		return nil
+	}
+	filename, err := channelFilename(w.filenames, ch)
+	if err != nil {
+		return err
+	}
+	if err := w.claim(filename, ch); err != nil {
+		return err
+	}
+	resumed := w.resume && isChannelFile(path.Join(w.dir, filename), ch.ID)
+	var size int64
+	if !resumed {
+		if size, err = writeChannelFile(w.dir, filename, w.dirPerm, w.perm, w.pretty, ch, w.budget); err != nil {
+			return err
+		}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if resumed {
+		w.resumed++
+	}
+	w.written += size
+	w.index.Channels = append(w.index.Channels, newChannelIndexEntry(ch, filename))
+	w.index.Stats.add(ch)
+	w.manifest.add(ch)
+	return nil
+}
+
+// claim reserves the filename for the channel. It fails if the filename template rendered the same
+// filename for another channel, which would otherwise be overwritten.
+func (w *directoryWriter) claim(filename string, ch ChannelWithMetadata) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if other, ok := w.used[filename]; ok {
+		return fmt.Errorf("filename %q of channel %v is already used by channel %v", filename, ch.name(), other)
+	}
+	if w.used == nil {
+		w.used = make(map[string]string)
+	}
+	w.used[filename] = ch.name()
+	return nil
+}
+
+func (w *directoryWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.resume {
+		w.log.Info("Skipped already written channels", "count", w.resumed)
+	}
+	w.index.SchemaVersion = SchemaVersion
+	w.index.Stats.finalize()
+	w.index.sort(w.order)
+	if err := writeJSON(path.Join(w.dir, IndexFilename), w.perm, w.pretty, w.index); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return writeErrorManifest(w.dir, w.perm, w.pretty, &w.manifest)
+}
+
+func (w *directoryWriter) BytesWritten() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.written
+}
+
+// arrayWriter streams all channels into a single file as one JSON array.
+// Channels are encoded one at a time, so memory usage does not grow with the number of channels.
+type arrayWriter struct {
+	pretty    bool
+	readyOnly bool
+	budget    *outputBudget
+
+	mu      sync.Mutex
+	file    *os.File
+	counter countingWriter
+	out     *bufio.Writer
+	count   int
+}
+
+func newArrayWriter(filename string, perm os.FileMode, pretty, readyOnly bool, budget *outputBudget) (*arrayWriter, error) {
+	file, err := createFile(filename, perm)
+	if err != nil {
+		return nil, err
+	}
+	w := &arrayWriter{pretty: pretty, readyOnly: readyOnly, budget: budget, file: file, counter: countingWriter{w: file}}
+	w.out = bufio.NewWriter(&w.counter)
+	if err := w.out.WriteByte('['); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *arrayWriter) WriteChannel(ch ChannelWithMetadata) error {
+	if omitChannel(w.readyOnly, ch) {
+		return nil
+	}
+	data, err := marshalChannel(ch, w.pretty, "  ")
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var sep string
+	if w.count > 0 {
+		sep = ","
+	}
+	if w.pretty {
+		sep += "\n  "
+	}
+	if !w.budget.reserve(len(sep) + len(data)) {
+		return ErrOutputLimit
+	}
+	if _, err := w.out.WriteString(sep); err != nil {
+		return err
+	}
+	if _, err := w.out.Write(data); err != nil {
+		return err
+	}
+	w.count++
+	return nil
+}
+
+func (w *arrayWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	end := "]\n"
+	if w.pretty && w.count > 0 {
+		end = "\n]\n"
+	}
+	if _, err := w.out.WriteString(end); err != nil {
+		w.file.Close()
+		return err
+	}
+	return errors.Join(w.out.Flush(), w.file.Close())
+}
+
+func (w *arrayWriter) BytesWritten() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.counter.n
+}
+
+// ndjsonWriter writes one JSON encoded channel per line. Pretty printing is not supported,
+// because each channel must stay on a single line.
+type ndjsonWriter struct {
+	readyOnly bool
+	budget    *outputBudget
+
+	mu      sync.Mutex
+	counter countingWriter
+	out     *bufio.Writer
+	closer  io.Closer
+}
+
+// newNDJSONWriter writes to out & closes the optional closer on Close.
+func newNDJSONWriter(out io.Writer, closer io.Closer, readyOnly bool, budget *outputBudget) *ndjsonWriter {
+	w := &ndjsonWriter{readyOnly: readyOnly, budget: budget, counter: countingWriter{w: out}, closer: closer}
+	w.out = bufio.NewWriter(&w.counter)
+	return w
+}
+
+func (w *ndjsonWriter) WriteChannel(ch ChannelWithMetadata) error {
+	if omitChannel(w.readyOnly, ch) {
+		return nil
+	}
+	data, err := json.Marshal(ch)
+	if err != nil {
+		return err
+	}
+	if !w.budget.reserve(len(data) + 1) {
+		return ErrOutputLimit
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.out.Write(data); err != nil {
+		return err
+	}
+	return w.out.WriteByte('\n')
+}
+
+func (w *ndjsonWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.out.Flush()
+	if w.closer != nil {
+		err = errors.Join(err, w.closer.Close())
+	}
+	return err
+}
+
+func (w *ndjsonWriter) BytesWritten() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.counter.n
+}
+
+// statsWriter only aggregates statistics over the channels & prints them on Close.
+type statsWriter struct {
+	out    io.Writer
+	json   bool
+	pretty bool
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+func (w *statsWriter) WriteChannel(ch ChannelWithMetadata) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stats.add(ch)
+	return nil
+}
+
+func (w *statsWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stats.finalize()
+	if w.json {
+		enc := json.NewEncoder(w.out)
+		if w.pretty {
+			enc.SetIndent("", "  ")
+		}
+		return enc.Encode(w.stats)
+	}
+	_, err := fmt.Fprint(w.out, w.stats.String())
+	return err
+}
+
+// BytesWritten is always zero, as the statistics are no channel output.
+func (w *statsWriter) BytesWritten() int64 {
+	return 0
+}
+
+// csvWriter writes one row per frame of every channel into a single CSV file & the error manifest on Close.
+// With readyOnly, the frames of channels which are not ready are omitted.
+type csvWriter struct {
+	dir       string
+	perm      os.FileMode
+	pretty    bool
+	readyOnly bool
+
+	mu       sync.Mutex
+	file     *os.File
+	counter  countingWriter
+	csv      *csv.Writer
+	manifest ErrorManifest
+}
+
+func newCSVWriter(dir string, perm os.FileMode, pretty, readyOnly bool) (*csvWriter, error) {
+	file, err := createFile(path.Join(dir, FramesCSVFilename), perm)
+	if err != nil {
+		return nil, err
+	}
+	w := &csvWriter{dir: dir, perm: perm, pretty: pretty, readyOnly: readyOnly, file: file, counter: countingWriter{w: file}}
+	w.csv = csv.NewWriter(&w.counter)
+	header := []string{"channel_id", "frame_number", "is_last", "tx_hash", "inclusion_block", "frame_data_len", "skipped"}
+	if err := w.csv.Write(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *csvWriter) WriteChannel(ch ChannelWithMetadata) error {
+	skipped := skippedFrameMask(ch)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.manifest.add(ch)
+	if omitChannel(w.readyOnly, ch) {
+		return nil
+	}
+	for i, frame := range ch.Frames {
+		row := []string{
+			ch.ID.String(),
+			strconv.FormatUint(uint64(frame.Frame.FrameNumber), 10),
+			strconv.FormatBool(frame.Frame.IsLast),
+			frame.TxHash.String(),
+			strconv.FormatUint(frame.InclusionBlock, 10),
+			strconv.Itoa(frame.DataLen),
+			strconv.FormatBool(skipped[i]),
+		}
+		if err := w.csv.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *csvWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.csv.Flush()
+	if err := errors.Join(w.csv.Error(), w.file.Close()); err != nil {
+		return err
+	}
+	return writeErrorManifest(w.dir, w.perm, w.pretty, &w.manifest)
+}
+
+func (w *csvWriter) BytesWritten() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.counter.n
+}
+
+func writeErrorManifest(dir string, perm os.FileMode, pretty bool, manifest *ErrorManifest) error {
+	manifest.sort()
+	if err := writeJSON(path.Join(dir, ErrorsFilename), perm, pretty, manifest); err != nil {
+		return fmt.Errorf("failed to write error manifest: %w", err)
+	}
+	return nil
+}
+
+// skippedFrameMask reports for each of the channel's frames whether it is one of the skipped frames.
+// When identical frames occur multiple times the later occurrences are the skipped ones.
+func skippedFrameMask(ch ChannelWithMetadata) []bool {
+	type frameKey struct {
+		txHash      common.Hash
+		frameNumber uint16
+		isLast      bool
+	}
+	keyOf := func(frame FrameWithMetadata) frameKey {
+		return frameKey{frame.TxHash, frame.Frame.FrameNumber, frame.Frame.IsLast}
+	}
+	remaining := make(map[frameKey]int)
+	for _, frame := range ch.SkippedFrames {
+		remaining[keyOf(frame.FrameWithMetadata)]++
+	}
+	mask := make([]bool, len(ch.Frames))
+	for i := len(ch.Frames) - 1; i >= 0; i-- {
+		key := keyOf(ch.Frames[i])
+		if remaining[key] > 0 {
+			remaining[key]--
+			mask[i] = true
+		}
+	}
+	return mask
+}
+
+// DefaultFilenameTemplate is the default of Config.FilenameTemplate.
+const DefaultFilenameTemplate = "{{.Name}}.json"
+
+// ChannelFilenameData is the data available to Config.FilenameTemplate.
+type ChannelFilenameData struct {
+	ID derive.ChannelID
+	// Name is the channel ID, suffixed with the IDReuseIndex of channels whose ID was reused.
+	// Unlike the ID, it is unique for every channel.
+	Name                string
+	IDReuseIndex        int
+	FirstInclusionBlock uint64
+	InboxAddr           common.Address
+}
+
+func newFilenameTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultFilenameTemplate
+	}
+	tmpl, err := template.New("filename").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filename template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// channelFilename renders the filename of the channel, relative to the out directory.
+// Filenames which are absolute or escape the out directory are rejected.
+func channelFilename(tmpl *template.Template, ch ChannelWithMetadata) (string, error) {
+	data := ChannelFilenameData{ID: ch.ID, Name: ch.name(), IDReuseIndex: ch.IDReuseIndex}
+	if len(ch.Frames) > 0 {
+		data.FirstInclusionBlock = ch.Frames[0].InclusionBlock
+		data.InboxAddr = ch.Frames[0].InboxAddr
+	}
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render filename: %w", err)
+	}
+	filename := filepath.ToSlash(filepath.Clean(buf.String()))
+	if !filepath.IsLocal(filename) {
+		return "", fmt.Errorf("filename %q is not inside the out directory", buf.String())
+	}
+	return filename, nil
+}
+
+// writeChannelFile writes the channel to the filename relative to dir, creating its subdirectories.
+// It returns the size of the written file, or ErrOutputLimit if the file does not fit into the budget.
+func writeChannelFile(dir, filename string, dirPerm, perm os.FileMode, pretty bool, ch ChannelWithMetadata, budget *outputBudget) (int64, error) {
+	data, err := marshalChannel(ch, pretty, "")
+	if err != nil {
+		return 0, err
+	}
+	// Like writeJSON, the document is terminated by a newline
+	data = append(data, '\n')
+	if !budget.reserve(len(data)) {
+		return 0, ErrOutputLimit
+	}
+	if sub := path.Dir(filename); sub != "." {
+		if err := os.MkdirAll(path.Join(dir, sub), dirPerm); err != nil {
+			return 0, err
+		}
+	}
+	file, err := createFile(path.Join(dir, filename), perm)
+	if err != nil {
+		return 0, err
+	}
+	n, err := file.Write(data)
+	return int64(n), errors.Join(err, file.Close())
+}
+
+// marshalChannel returns the JSON encoding of the channel, indented with the prefix if pretty is set.
+func marshalChannel(ch ChannelWithMetadata, pretty bool, prefix string) ([]byte, error) {
+	if pretty {
+		return json.MarshalIndent(ch, prefix, "  ")
+	}
+	return json.Marshal(ch)
+}
+
+// isChannelFile returns true if the file holds a complete JSON document of the channel.
+func isChannelFile(filename string, id derive.ChannelID) bool {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return false
+	}
+	// Batches cannot be unmarshalled, but decoding the ID still validates the whole document.
+	var ch struct {
+		ID derive.ChannelID `json:"id"`
+	}
+	return json.Unmarshal(data, &ch) == nil && ch.ID == id
+}
+
+// writeJSON writes v as JSON into the file, indented if pretty is set.
+func writeJSON(filename string, perm os.FileMode, pretty bool, v any) error {
+	file, err := createFile(filename, perm)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(file)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(v); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// createFile creates or truncates the named file like os.Create, but with the given permissions.
+func createFile(filename string, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perm)
+}
@@ -0,0 +1,8 @@
+package reassemble
+
+const (
+	// FramesParquetFilename & ChannelsParquetFilename are the names of the tables written to the out
+	// directory in parquet mode.
+	FramesParquetFilename   = "frames.parquet"
+	ChannelsParquetFilename = "channels.parquet"
+)
@@ -0,0 +1,16 @@
+//go:build !parquet
+// +build !parquet
+
+package reassemble
+
+import (
+	"errors"
+	"os"
+)
+
+// newParquetWriter fails in builds without the parquet build tag, so that the parquet dependency is only
+// linked into builds which need it. The purego tag must be set as well, because the assembly of the parquet
+// dependency does not link with toolchains newer than the module's.
+func newParquetWriter(dir string, perm os.FileMode, pretty, readyOnly bool) (channelWriter, error) {
+	return nil, errors.New("parquet output requires a build with the parquet,purego build tags")
+}
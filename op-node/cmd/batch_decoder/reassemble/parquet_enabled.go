@@ -0,0 +1,156 @@
+//go:build parquet
+// +build parquet
+
+package reassemble
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// The parquet output is built with -tags parquet,purego. The purego tag disables the assembly of the
+// parquet dependency, which does not link with toolchains newer than the module's.
+
+// parquetWriter writes the frames & channels into two parquet tables & the error manifest on Close.
+// With readyOnly, channels which are not ready are only listed in the error manifest.
+type parquetWriter struct {
+	dir       string
+	perm      os.FileMode
+	pretty    bool
+	readyOnly bool
+
+	mu             sync.Mutex
+	frameFile      *os.File
+	frameCounter   countingWriter
+	frames         *parquet.GenericWriter[parquetFrameRow]
+	channelFile    *os.File
+	channelCounter countingWriter
+	channels       *parquet.GenericWriter[parquetChannelRow]
+	manifest       ErrorManifest
+}
+
+func newParquetWriter(dir string, perm os.FileMode, pretty, readyOnly bool) (channelWriter, error) {
+	frameFile, err := createFile(path.Join(dir, FramesParquetFilename), perm)
+	if err != nil {
+		return nil, err
+	}
+	channelFile, err := createFile(path.Join(dir, ChannelsParquetFilename), perm)
+	if err != nil {
+		frameFile.Close()
+		return nil, err
+	}
+	w := &parquetWriter{dir: dir, perm: perm, pretty: pretty, readyOnly: readyOnly, frameFile: frameFile, channelFile: channelFile,
+		frameCounter: countingWriter{w: frameFile}, channelCounter: countingWriter{w: channelFile}}
+	w.frames = parquet.NewGenericWriter[parquetFrameRow](&w.frameCounter)
+	w.channels = parquet.NewGenericWriter[parquetChannelRow](&w.channelCounter)
+	return w, nil
+}
+
+func (w *parquetWriter) WriteChannel(ch ChannelWithMetadata) error {
+	frames := parquetFrameRows(ch)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.manifest.add(ch)
+	if omitChannel(w.readyOnly, ch) {
+		return nil
+	}
+	if _, err := w.frames.Write(frames); err != nil {
+		return err
+	}
+	_, err := w.channels.Write([]parquetChannelRow{newParquetChannelRow(ch)})
+	return err
+}
+
+func (w *parquetWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := errors.Join(w.frames.Close(), w.frameFile.Close(), w.channels.Close(), w.channelFile.Close())
+	if err != nil {
+		return err
+	}
+	return writeErrorManifest(w.dir, w.perm, w.pretty, &w.manifest)
+}
+
+func (w *parquetWriter) BytesWritten() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.frameCounter.n + w.channelCounter.n
+}
+
+// parquetFrameRow is a row of the FramesParquetFilename table.
+type parquetFrameRow struct {
+	ChannelID      string `parquet:"channel_id"`
+	FrameNumber    uint32 `parquet:"frame_number"`
+	IsLast         bool   `parquet:"is_last"`
+	TxHash         string `parquet:"tx_hash"`
+	InclusionBlock uint64 `parquet:"inclusion_block"`
+	FrameDataLen   int    `parquet:"frame_data_len"`
+	Skipped        bool   `parquet:"skipped"`
+	IsReady        bool   `parquet:"is_ready"`
+}
+
+// parquetChannelRow is a row of the ChannelsParquetFilename table.
+type parquetChannelRow struct {
+	ChannelID           string `parquet:"channel_id"`
+	IDReuseIndex        int    `parquet:"id_reuse_index"`
+	IsReady             bool   `parquet:"is_ready"`
+	NotReadyReason      string `parquet:"not_ready_reason"`
+	Closed              bool   `parquet:"closed"`
+	InvalidFrames       bool   `parquet:"invalid_frames"`
+	InvalidBatches      bool   `parquet:"invalid_batches"`
+	Frames              int    `parquet:"frames"`
+	SkippedFrames       int    `parquet:"skipped_frames"`
+	CompressedSize      uint64 `parquet:"compressed_size"`
+	DecompressedSize    uint64 `parquet:"decompressed_size"`
+	CompressionType     string `parquet:"compression_type"`
+	FirstInclusionBlock uint64 `parquet:"first_inclusion_block"`
+	LastInclusionBlock  uint64 `parquet:"last_inclusion_block"`
+	Batches             int    `parquet:"batches"`
+	TotalL2Txns         int    `parquet:"total_l2_txns"`
+	L1GasUsed           uint64 `parquet:"l1_gas_used"`
+}
+
+// parquetFrameRows returns a row per frame of the channel, like the rows of the csvWriter.
+func parquetFrameRows(ch ChannelWithMetadata) []parquetFrameRow {
+	skipped := skippedFrameMask(ch)
+	rows := make([]parquetFrameRow, 0, len(ch.Frames))
+	for i, frame := range ch.Frames {
+		rows = append(rows, parquetFrameRow{
+			ChannelID:      ch.ID.String(),
+			FrameNumber:    uint32(frame.Frame.FrameNumber),
+			IsLast:         frame.Frame.IsLast,
+			TxHash:         frame.TxHash.String(),
+			InclusionBlock: frame.InclusionBlock,
+			FrameDataLen:   frame.DataLen,
+			Skipped:        skipped[i],
+			IsReady:        ch.IsReady,
+		})
+	}
+	return rows
+}
+
+func newParquetChannelRow(ch ChannelWithMetadata) parquetChannelRow {
+	return parquetChannelRow{
+		ChannelID:           ch.ID.String(),
+		IDReuseIndex:        ch.IDReuseIndex,
+		IsReady:             ch.IsReady,
+		NotReadyReason:      ch.NotReadyReason,
+		Closed:              ch.Closed,
+		InvalidFrames:       ch.InvalidFrames,
+		InvalidBatches:      ch.InvalidBatches,
+		Frames:              len(ch.Frames),
+		SkippedFrames:       len(ch.SkippedFrames),
+		CompressedSize:      ch.CompressedSize,
+		DecompressedSize:    ch.DecompressedSize,
+		CompressionType:     ch.CompressionType,
+		FirstInclusionBlock: ch.FirstInclusionBlock,
+		LastInclusionBlock:  ch.LastInclusionBlock,
+		Batches:             len(ch.Batches),
+		TotalL2Txns:         ch.TotalL2Txns,
+		L1GasUsed:           ch.L1GasUsed,
+	}
+}
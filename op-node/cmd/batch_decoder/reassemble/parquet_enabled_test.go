@@ -0,0 +1,40 @@
+//go:build parquet
+// +build parquet
+
+package reassemble
+
+import (
+	"context"
+	"path"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelsParquetOutput(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	id := derive.ChannelID{0x26}
+	writeTransaction(t, in, testTransaction(0, 10, 0, derive.Frame{ID: id, Data: []byte{0x01}}))
+	writeTransaction(t, in, testTransaction(1, 11, 0, derive.Frame{ID: id, FrameNumber: 1, IsLast: true}))
+
+	result, err := Channels(context.Background(), Config{InDirectory: in, OutDirectory: out, OutputFormat: OutputFormatParquet}, &rollup.Config{})
+	require.NoError(t, err)
+	require.Positive(t, result.BytesWritten)
+
+	frames, err := parquet.ReadFile[parquetFrameRow](path.Join(out, FramesParquetFilename))
+	require.NoError(t, err)
+	require.Len(t, frames, 2)
+	require.Equal(t, id.String(), frames[1].ChannelID)
+	require.Equal(t, uint32(1), frames[1].FrameNumber)
+	require.Equal(t, uint64(11), frames[1].InclusionBlock)
+
+	channels, err := parquet.ReadFile[parquetChannelRow](path.Join(out, ChannelsParquetFilename))
+	require.NoError(t, err)
+	require.Len(t, channels, 1)
+	require.True(t, channels[0].IsReady)
+	require.Equal(t, 2, channels[0].Frames)
+	require.FileExists(t, path.Join(out, ErrorsFilename))
+}
@@ -0,0 +1,23 @@
+package reassemble
+
+import (
+	"os"
+	"path"
+)
+
+// PayloadSuffix is the file extension of the decompressed channel payloads written to Config.DumpPayloads.
+const PayloadSuffix = ".bin"
+
+// writePayloadFile writes the decompressed payload of the channel into dir. Channels which are not
+// ready have no payload & are skipped. Ready channels which failed to decompress are only logged.
+func writePayloadFile(config Config, ch ChannelWithMetadata) error {
+	if !ch.IsReady {
+		return nil
+	}
+	if !ch.Decompressed {
+		config.logger().Warn("No payload to dump, channel failed to decompress", "channel_id", ch.ID)
+		return nil
+	}
+	filename := path.Join(config.DumpPayloads, ch.name()+PayloadSuffix)
+	return os.WriteFile(filename, ch.payload, config.filePerm())
+}
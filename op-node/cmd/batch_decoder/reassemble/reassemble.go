@@ -1,54 +1,686 @@
 package reassemble
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"math"
 	"math/big"
 	"os"
 	"path"
+	"runtime"
+	"slices"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
 	"github.com/ethereum-optimism/optimism/op-node/rollup"
 	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
 	"github.com/ethereum-optimism/optimism/op-service/eth"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/sync/errgroup"
 )
 
+// SchemaVersion is the version of the structure of the channel & index output files.
+// It must be bumped whenever fields are removed, renamed or change their meaning.
+const SchemaVersion = "2"
+
+// DefaultMaxFramesPerChannel is the default of Config.MaxFramesPerChannel. It exceeds the number of
+// distinct frame numbers, so that only channels with excessive duplicate frames are affected.
+const DefaultMaxFramesPerChannel = 100_000
+
 type ChannelWithMetadata struct {
-	ID             derive.ChannelID         `json:"id"`
-	IsReady        bool                     `json:"is_ready"`
-	InvalidFrames  bool                     `json:"invalid_frames"`
-	InvalidBatches bool                     `json:"invalid_batches"`
-	Frames         []FrameWithMetadata      `json:"frames"`
-	Batches        []derive.Batch           `json:"batches"`
-	BatchTypes     []int                    `json:"batch_types"`
-	ComprAlgos     []derive.CompressionAlgo `json:"compr_algos"`
+	// SchemaVersion is the SchemaVersion of the tool which produced the channel
+	SchemaVersion string           `json:"schema_version"`
+	ID            derive.ChannelID `json:"id"`
+	IsReady       bool             `json:"is_ready"`
+	// NotReadyReason is one of the NotReadyReason constants if the channel is not ready
+	NotReadyReason string              `json:"not_ready_reason,omitempty"`
+	InvalidFrames  bool                `json:"invalid_frames"`
+	InvalidBatches bool                `json:"invalid_batches"`
+	Frames         []FrameWithMetadata `json:"frames"`
+	// SkippedFrames are the frames which were not accepted by the channel
+	SkippedFrames []SkippedFrame `json:"skipped_frames"`
+	Batches       []derive.Batch `json:"batches"`
+	BatchTypes    []int          `json:"batch_types"`
+	// PayloadBatchTypes are the distinct batch types present in the channel, in ascending order.
+	// They are read from the leading type byte of each batch, without decoding the batches, so they are
+	// also available with Config.BatchTypesOnly.
+	PayloadBatchTypes []int                    `json:"payload_batch_types,omitempty"`
+	ComprAlgos        []derive.CompressionAlgo `json:"compr_algos"`
+	// DecodeError is the first error encountered while decoding batches from a ready channel.
+	DecodeError string `json:"decode_error,omitempty"`
+	// SpanBatchBlocks lists every L2 block contained in the span batches of the channel.
+	SpanBatchBlocks []SpanBatchBlock `json:"span_batch_blocks,omitempty"`
+	// Replay is the result of the channel bank replay. It is only set if Config.Replay is enabled.
+	Replay *ReplayResult `json:"replay,omitempty"`
+	// BatchEpochs are the L1 origins referenced by each batch, in batch order
+	BatchEpochs []BatchEpoch `json:"batch_epochs,omitempty"`
+	// BatchTxCounts are the number of L2 transactions of each batch, in batch order. The counts of span
+	// batches cover all their blocks. TotalL2Txns is their sum.
+	BatchTxCounts []int `json:"batch_tx_counts,omitempty"`
+	TotalL2Txns   int   `json:"total_l2_txns"`
+	// BatchTxGas is the sum of the gas limits of the L2 transactions of each batch, in batch order.
+	// Batches do not encode the gas limit of their L2 blocks, which is set by the L1 system config.
+	BatchTxGas []uint64 `json:"batch_tx_gas,omitempty"`
+	// DerivedL2Blocks are the numbers of the L2 blocks of all batches, in batch order.
+	// They are only set for channels whose batches all decoded, if the L2 block time is configured.
+	DerivedL2Blocks []uint64 `json:"derived_l2_blocks,omitempty"`
+	// TimestampAnomaly lists the indices of the batches whose first L2 block does not follow the last
+	// block of the preceding batch by exactly the L2 block time. It is only checked if the L2 block
+	// time is configured. Anomalies indicate corrupt channel data or a batcher bug.
+	TimestampAnomaly []int `json:"timestamp_anomaly,omitempty"`
+	// CompressedSize is the total frame data size of the channel
+	CompressedSize uint64 `json:"compressed_size"`
+	// AvgFrameDataSize is the average data size of the accepted frames of the channel
+	AvgFrameDataSize float64 `json:"avg_frame_data_size"`
+	// FrameFillRatio is the average encoded size of the accepted frames, including the frame overhead,
+	// relative to Config.MaxFrameSize. Low ratios hint at inefficient batcher framing.
+	// It is only set if a max frame size is configured.
+	FrameFillRatio float64 `json:"frame_fill_ratio,omitempty"`
+	// FrameSizeHistogram counts the accepted frames of the channel by data size, in the buckets of
+	// Config.FrameSizeBuckets
+	FrameSizeHistogram []FrameSizeBucket `json:"frame_size_histogram,omitempty"`
+	// CompressionType is the compression algorithm of the channel data, "zlib" or "brotli".
+	// It is CompressionTypeUnknown for channels which are not ready or use an unrecognized algorithm.
+	CompressionType string `json:"compression_type"`
+	// Decompressed is true if the channel is ready and its data could be decompressed
+	Decompressed bool `json:"decompressed"`
+	// OversizedChannel is true if the decompressed size exceeds the MaxRLPBytesPerChannel limit, in which
+	// case derivation drops the batches past the limit. MaxRLPBytes is the applied limit, which is only
+	// set for ready channels. Decompression stops past the limit, so the DecompressedSize of oversized
+	// channels is MaxRLPBytes+1.
+	OversizedChannel bool    `json:"oversized_channel"`
+	MaxRLPBytes      uint64  `json:"max_rlp_bytes,omitempty"`
+	DecompressedSize uint64  `json:"decompressed_size"`
+	CompressionRatio float64 `json:"compression_ratio"`
+	// OpenBlock is the L1 block in which the first frame of the channel was included
+	OpenBlock uint64 `json:"open_block"`
+	// TimeoutBlock is the last L1 block in which frames can be added to the channel.
+	// It is only set if a channel timeout is configured.
+	TimeoutBlock uint64 `json:"timeout_block,omitempty"`
+	// TimedOut is true if frames of the channel were included after the timeout block.
+	// A timed out channel is never ready.
+	TimedOut bool `json:"timed_out"`
+	// LikelyTruncatedByWindow is true if the channel is not ready, but could still receive frames after
+	// Config.EndBlock, because it opened less than the channel timeout before it. Such a channel is likely
+	// incomplete only because its later frames are outside of the loaded block range. The chain spec
+	// channel timeout is used if Config.ChannelTimeout is zero.
+	LikelyTruncatedByWindow bool `json:"likely_truncated_by_window"`
+	// AssembledSize is the size of the frame data concatenated in frame number order.
+	// It is only set for closed channels.
+	AssembledSize uint64 `json:"assembled_size"`
+	// AssemblyGap is true if a closed channel is missing frames below the closing frame number
+	AssemblyGap bool `json:"assembly_gap"`
+	// Closed is true if the channel accepted a closing frame
+	Closed bool `json:"closed"`
+	// MissingFrameNumbers are the frame numbers not accepted by the channel, up to the closing frame
+	// number of a closed channel or the highest accepted frame number of an open one.
+	MissingFrameNumbers []uint16 `json:"missing_frame_numbers,omitempty"`
+	// HighestFrameNumber is the closing frame number of a closed channel or the highest accepted frame
+	// number of an open one. It is nil if the channel accepted no frames.
+	HighestFrameNumber *uint16 `json:"highest_frame_number,omitempty"`
+	// MaxFrameReached is true if the channel accepted a frame with the maximum frame number,
+	// so that it cannot hold any further frames.
+	MaxFrameReached bool `json:"max_frame_reached"`
+	// ClosingTxHash & ClosingBlock identify the transaction which carried the accepted closing frame
+	ClosingTxHash common.Hash `json:"closing_tx_hash"`
+	ClosingBlock  uint64      `json:"closing_block"`
+	// ClosingFrameCount is the number of frames of the channel marked as last, i.e. the accepted closing
+	// frame & all skipped ones, including duplicates. It is exactly 1 for a well-formed channel.
+	// Values above 1 indicate batcher misbehavior.
+	ClosingFrameCount int `json:"closing_frame_count"`
+	// Timeline lists the frames in order of arrival on L1. Only set if Config.Timeline is enabled.
+	Timeline []FrameArrival `json:"timeline,omitempty"`
+	// EmptyFrames are the frames of the channel without any data. These usually indicate a batcher bug.
+	EmptyFrames []FrameWithMetadata `json:"empty_frames,omitempty"`
+	// Truncated is true if frames were dropped because of Config.MaxFrameNumber.
+	// The channel then does not reflect the real data on L1.
+	Truncated bool `json:"truncated"`
+	// TruncatedPrefix describes the decompression of the frames up to Config.MaxFrameNumber.
+	// It is only set for truncated channels which are not ready.
+	TruncatedPrefix *TruncatedPrefix `json:"truncated_prefix,omitempty"`
+	// TruncatedFrames are the frames whose data length does not match the length declared in their
+	// frame header, e.g. because of a corrupt transaction file. They are not added to the channel.
+	TruncatedFrames []FrameWithMetadata `json:"truncated_frames,omitempty"`
+	// ConflictingFrames are the skipped frames whose frame number was accepted with different content
+	ConflictingFrames []ConflictingFrame `json:"conflicting_frames,omitempty"`
+	// LateFrames are the frames accepted after the closing frame of the channel, filling in a frame
+	// number below it. Unlike skipped frames, these are benign reorderings of the batcher submissions.
+	LateFrames []FrameWithMetadata `json:"late_frames,omitempty"`
+	// OverLimit is true if the channel had more frames than Config.MaxFramesPerChannel.
+	// The frames past the limit, in inclusion order, were skipped.
+	OverLimit bool `json:"over_limit"`
+	// MaxInclusionGap is the largest difference in inclusion blocks between two accepted frames
+	// with consecutive frame numbers. A large gap hints at a stalled or interrupted batcher.
+	MaxInclusionGap uint64 `json:"max_inclusion_gap"`
+	// FirstInclusionBlock & LastInclusionBlock are the inclusion blocks of the first & last frame of the
+	// channel, including skipped frames. BlockSpan is the number of L1 blocks between both.
+	FirstInclusionBlock uint64 `json:"first_inclusion_block"`
+	LastInclusionBlock  uint64 `json:"last_inclusion_block"`
+	BlockSpan           uint64 `json:"block_span"`
+	// InclusionBlocks is the number of distinct L1 blocks in which frames of the channel were included
+	InclusionBlocks int `json:"inclusion_blocks"`
+	// RoundTripMatch is true if the re-encoded batches match the decompressed channel payload.
+	// It is only set if Config.VerifyRoundTrip is enabled & all batches of the channel decoded.
+	RoundTripMatch *bool `json:"round_trip_match,omitempty"`
+	// RoundTripDiff summarizes the difference if the round trip did not match
+	RoundTripDiff string `json:"round_trip_diff,omitempty"`
+	// L1GasUsed is the calldata gas of all transactions which carried frames of the channel.
+	// Each transaction is counted once, even if it carried multiple frames of the channel.
+	L1GasUsed uint64 `json:"l1_gas_used"`
+	// PostProcessErrors are the errors returned by the Config.PostProcessors for the channel
+	PostProcessErrors []string `json:"post_process_errors,omitempty"`
+	// IDReused is true if frames of the channel ID were included more than the channel timeout
+	// blocks apart, which implies that the ID was reused by unrelated channels. The frames are then
+	// split into distinct channels at these gaps, numbered in inclusion order by IDReuseIndex.
+	IDReused     bool `json:"id_reused"`
+	IDReuseIndex int  `json:"id_reuse_index,omitempty"`
+
+	// payload is the decompressed channel data. It is only retained if Config.DumpPayloads is set.
+	payload []byte
+	// unsampled is true if the channel is not part of the Config.SampleCount sample
+	unsampled bool
+}
+
+// name is the channel ID, suffixed with the IDReuseIndex if the ID was reused by later channels.
+func (ch ChannelWithMetadata) name() string {
+	if ch.IDReuseIndex == 0 {
+		return ch.ID.String()
+	}
+	return fmt.Sprintf("%s-%d", ch.ID.String(), ch.IDReuseIndex)
+}
+
+// PostProcessor enriches or validates a processed channel before it is written. A returned error is
+// recorded in ChannelWithMetadata.PostProcessErrors & lists the channel in the error manifest.
+type PostProcessor func(ch *ChannelWithMetadata) error
+
+// TruncatedPrefix is the result of decompressing the contiguous frames of a truncated channel,
+// starting at frame 0. It helps to find the frame at which decompression of a channel breaks.
+type TruncatedPrefix struct {
+	// Frames is the number of contiguous frames in the prefix
+	Frames           int    `json:"frames"`
+	Size             uint64 `json:"size"`
+	DecompressedSize uint64 `json:"decompressed_size"`
+	// DecompressError is the error at the end of the decompressed data. An unexpected EOF is
+	// expected for a prefix which does not contain the whole channel.
+	DecompressError string `json:"decompress_error,omitempty"`
+}
+
+// FrameArrival records when a frame of a channel arrived on L1.
+type FrameArrival struct {
+	InclusionBlock uint64      `json:"inclusion_block"`
+	TxHash         common.Hash `json:"transaction_hash"`
+	FrameNumber    uint16      `json:"frame_number"`
+}
+
+// SpanBatchBlock is a single L2 block derived from a span batch.
+type SpanBatchBlock struct {
+	// BatchIndex is the index of the span batch inside ChannelWithMetadata.Batches
+	BatchIndex int    `json:"batch_index"`
+	Timestamp  uint64 `json:"timestamp"`
+	// RelTimestamp is the timestamp relative to the L2 genesis time, as encoded in the span batch
+	RelTimestamp uint64 `json:"rel_timestamp"`
+	L1Origin     uint64 `json:"l1_origin"`
+	TxCount      int    `json:"tx_count"`
+}
+
+// BatchEpoch is the L1 origin referenced by a batch. The L1 origins of the individual blocks of
+// span batches are listed in ChannelWithMetadata.SpanBatchBlocks.
+type BatchEpoch struct {
+	// EpochNum is the epoch of a singular batch, or the epoch of the first block of a span batch
+	EpochNum uint64 `json:"epoch_num"`
+	// LastEpochNum is the epoch of the last block of a span batch. It equals EpochNum for singular batches.
+	LastEpochNum uint64 `json:"last_epoch_num"`
+	// EpochHash is the epoch hash of a singular batch
+	EpochHash *common.Hash `json:"epoch_hash,omitempty"`
+	// L1OriginCheck is the prefix of the L1 origin hash of the last block of a span batch
+	L1OriginCheck hexutil.Bytes `json:"l1_origin_check,omitempty"`
+}
+
+func batchEpochs(batches []derive.Batch) []BatchEpoch {
+	var epochs []BatchEpoch
+	for _, batch := range batches {
+		if b, ok := batch.AsSingularBatch(); ok {
+			epochs = append(epochs, BatchEpoch{
+				EpochNum:     uint64(b.EpochNum),
+				LastEpochNum: uint64(b.EpochNum),
+				EpochHash:    &b.EpochHash,
+			})
+		} else if b, ok := batch.AsSpanBatch(); ok && b.GetBlockCount() > 0 {
+			epochs = append(epochs, BatchEpoch{
+				EpochNum:      b.GetBlockEpochNum(0),
+				LastEpochNum:  b.GetBlockEpochNum(b.GetBlockCount() - 1),
+				L1OriginCheck: b.L1OriginCheck[:],
+			})
+		} else {
+			epochs = append(epochs, BatchEpoch{})
+		}
+	}
+	return epochs
+}
+
+// batchTxCounts returns the number of L2 transactions of each batch & the sum of their gas limits.
+// Batches which failed to decode count zero, as do the gas limits of transactions which cannot be decoded.
+func batchTxCounts(batches []derive.Batch) (counts []int, gas []uint64, total int) {
+	for _, batch := range batches {
+		var txs []hexutil.Bytes
+		if b, ok := batch.AsSingularBatch(); ok && b != nil {
+			txs = b.Transactions
+		} else if b, ok := batch.AsSpanBatch(); ok && b != nil {
+			for i := 0; i < b.GetBlockCount(); i++ {
+				txs = append(txs, b.GetBlockTransactions(i)...)
+			}
+		}
+		var batchGas uint64
+		for _, data := range txs {
+			var tx types.Transaction
+			if tx.UnmarshalBinary(data) == nil {
+				batchGas += tx.Gas()
+			}
+		}
+		counts = append(counts, len(txs))
+		gas = append(gas, batchGas)
+		total += len(txs)
+	}
+	return counts, gas, total
+}
+
+// Reasons for a frame not being accepted by its channel
+const (
+	// SkipReasonDuplicate is used for a frame whose frame number was already added to the channel
+	SkipReasonDuplicate = "duplicate"
+	// SkipReasonPastChannelEnd is used for a frame numbered at or past the closing frame of a closed channel
+	SkipReasonPastChannelEnd = "past_channel_end"
+	// SkipReasonChannelAlreadyClosed is used for a closing frame of an already closed channel
+	SkipReasonChannelAlreadyClosed = "channel_already_closed"
+	// SkipReasonChannelReady is used for frames following the frame which made the channel ready
+	SkipReasonChannelReady = "channel_ready"
+	// SkipReasonEmpty is used for frames without data if Config.SkipEmptyFrames is enabled
+	SkipReasonEmpty = "empty"
+	// SkipReasonTruncated is used for frames numbered above Config.MaxFrameNumber
+	SkipReasonTruncated = "truncated"
+	// SkipReasonPreBedrock is used for frames included before the L1 genesis block of the rollup
+	// with Config.LegacyBatches, whose transaction could not be decoded as a legacy batch either
+	SkipReasonPreBedrock = "pre_bedrock"
+	// SkipReasonOverLimit is used for the frames of a channel past Config.MaxFramesPerChannel
+	SkipReasonOverLimit = "over_limit"
+	// SkipReasonTruncatedData is used for frames with less or more data than declared in their frame header
+	SkipReasonTruncatedData = "truncated_data"
+	// SkipReasonConflicting is used for a frame whose frame number was already added to the channel
+	// with different data or a different closing flag
+	SkipReasonConflicting = "conflicting"
+	// SkipReasonPrunedByClose is used for a frame accepted by the channel, but pruned by a later accepted
+	// closing frame with a lower frame number
+	SkipReasonPrunedByClose = "pruned_by_close"
+	// SkipReasonRejected is used for frames rejected by the channel for any other reason
+	SkipReasonRejected = "rejected"
+)
+
+// ConflictingFrame describes two frames with the same frame number but different content. Unlike a
+// resubmitted duplicate, this hints at data corruption or a misbehaving batcher.
+type ConflictingFrame struct {
+	FrameNumber uint16 `json:"frame_number"`
+	// KeptTxHash carried the frame accepted by the channel, ConflictingTxHash the skipped one
+	KeptTxHash        common.Hash `json:"kept_tx_hash"`
+	ConflictingTxHash common.Hash `json:"conflicting_tx_hash"`
+}
+
+// Reasons for a channel not being ready
+const (
+	// NotReadyReasonNotClosed is used for channels without an accepted closing frame
+	NotReadyReasonNotClosed = "not_closed"
+	// NotReadyReasonMissingFrames is used for closed channels missing frames below the closing frame
+	NotReadyReasonMissingFrames = "missing_frames"
+	// NotReadyReasonTimedOut is used for channels with frames included after the channel timeout
+	NotReadyReasonTimedOut = "timed_out"
+	// NotReadyReasonDecompressionFailed is used with Config.StrictReady for complete channels whose
+	// data fails to decompress
+	NotReadyReasonDecompressionFailed = "decompression_failed"
+)
+
+const (
+	// FrameDecisionAccepted is traced for a frame accepted by the channel
+	FrameDecisionAccepted = "accepted"
+	// FrameDecisionClosed is traced for a closing frame accepted by the channel.
+	// Frames which are not accepted are traced with their skip reason.
+	FrameDecisionClosed = "channel_closed"
+)
+
+// SkippedFrame is a frame which was not accepted by its channel.
+type SkippedFrame struct {
+	FrameWithMetadata
+	Reason string `json:"reason"`
 }
 
 type FrameWithMetadata struct {
-	TxHash         common.Hash  `json:"transaction_hash"`
-	InclusionBlock uint64       `json:"inclusion_block"`
-	Timestamp      uint64       `json:"timestamp"`
-	BlockHash      common.Hash  `json:"block_hash"`
-	Frame          derive.Frame `json:"frame"`
+	TxHash         common.Hash `json:"transaction_hash"`
+	InclusionBlock uint64      `json:"inclusion_block"`
+	// TxIndex is the index of the transaction inside the inclusion block
+	TxIndex uint64 `json:"tx_index"`
+	// InboxAddr is the batch inbox address targeted by the transaction
+	InboxAddr common.Address `json:"inbox_address"`
+	Timestamp uint64         `json:"timestamp"`
+	BlockHash common.Hash    `json:"block_hash"`
+	Frame     derive.Frame   `json:"frame"`
+	// Blob is true if the frame was carried by a blob of the transaction instead of its calldata.
+	// The fetch command decodes the frames of blob transactions from their blobs.
+	Blob bool `json:"blob"`
+	// DataLen is the length of the frame data
+	DataLen int `json:"data_len"`
+	// DeclaredLen is the data length declared in the frame header of the transaction calldata.
+	// It is nil if the calldata of the transaction cannot be parsed, e.g. for blob transactions.
+	DeclaredLen *int `json:"declared_len,omitempty"`
+	// CalldataGas is the calldata gas of the whole transaction carrying the frame, priced by the
+	// Config.GasModel
+	CalldataGas uint64 `json:"calldata_gas"`
+	// Calldata is the input of the transaction carrying the frame.
+	// It is only set if Config.IncludeRawCalldata is enabled.
+	Calldata hexutil.Bytes `json:"calldata,omitempty"`
+
+	// hexData encodes the frame data as 0x-prefixed hex instead of base64, see Config.HexFrameData
+	hexData bool
+}
+
+// hexFrame is a derive.Frame with hex encoded data
+type hexFrame struct {
+	ID          derive.ChannelID `json:"id"`
+	FrameNumber uint16           `json:"frame_number"`
+	Data        hexutil.Bytes    `json:"data"`
+	IsLast      bool             `json:"is_last"`
+}
+
+// frameWithMetadata has no methods, so that it is encoded like a plain struct
+type frameWithMetadata FrameWithMetadata
+
+// frameJSON is the JSON object of a FrameWithMetadata. Frame is a derive.Frame, or a hexFrame if
+// the frame data is hex encoded.
+type frameJSON struct {
+	frameWithMetadata
+	Frame any `json:"frame"`
+}
+
+func (f FrameWithMetadata) jsonObject() frameJSON {
+	if f.hexData {
+		return frameJSON{frameWithMetadata(f), hexFrame{f.Frame.ID, f.Frame.FrameNumber, f.Frame.Data, f.Frame.IsLast}}
+	}
+	return frameJSON{frameWithMetadata(f), f.Frame}
+}
+
+func (f FrameWithMetadata) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.jsonObject())
+}
+
+// UnmarshalJSON decodes both base64 & hex encoded frame data. Data which is 0x-prefixed & valid hex
+// is decoded as hex.
+func (f *FrameWithMetadata) UnmarshalJSON(data []byte) error {
+	var v struct {
+		frameWithMetadata
+		Frame struct {
+			ID          derive.ChannelID `json:"id"`
+			FrameNumber uint16           `json:"frame_number"`
+			Data        json.RawMessage  `json:"data"`
+			IsLast      bool             `json:"is_last"`
+		} `json:"frame"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*f = FrameWithMetadata(v.frameWithMetadata)
+	f.Frame = derive.Frame{ID: v.Frame.ID, FrameNumber: v.Frame.FrameNumber, IsLast: v.Frame.IsLast}
+	var hexData hexutil.Bytes
+	if bytes.HasPrefix(v.Frame.Data, []byte(`"0x`)) && json.Unmarshal(v.Frame.Data, &hexData) == nil {
+		f.Frame.Data, f.hexData = hexData, true
+		return nil
+	}
+	if len(v.Frame.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(v.Frame.Data, &f.Frame.Data)
+}
+
+// MarshalJSON adds the reason to the JSON object of the frame. It is required, because the promoted
+// FrameWithMetadata.MarshalJSON would omit the reason.
+func (f SkippedFrame) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		frameJSON
+		Reason string `json:"reason"`
+	}{f.FrameWithMetadata.jsonObject(), f.Reason})
+}
+
+// UnmarshalJSON decodes the reason, which the promoted FrameWithMetadata.UnmarshalJSON would ignore.
+func (f *SkippedFrame) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	f.Reason = v.Reason
+	return f.FrameWithMetadata.UnmarshalJSON(data)
 }
 
 type Config struct {
-	BatchInbox    common.Address
-	InDirectory   string
-	OutDirectory  string
+	// BatchInboxes are the inbox addresses of the transactions to load.
+	// Transactions to any inbox are loaded if empty or if one of the addresses is the zero address.
+	BatchInboxes []common.Address
+	// SenderFilter restricts loading to the transactions of this sender, e.g. to isolate one batcher
+	// during a key rotation. Transactions of all senders are loaded if it is the zero address.
+	SenderFilter common.Address
+	InDirectory  string
+	// InDirectories are further input directories, loaded together with the InDirectory, e.g. for fetch
+	// output partitioned over time. A transaction present in several directories is only loaded once.
+	InDirectories []string
+	// Source provides the transactions instead of InDirectory or InFile, e.g. from memory.
+	// It is mutually exclusive with InDirectory & InFile.
+	Source TransactionSource
+	// InFile is a file with one JSON encoded transaction per line.
+	// It is mutually exclusive with InDirectory.
+	InFile string
+	// InArchive is a tar archive, optionally gzip compressed, of a directory with one transaction file
+	// per transaction. Its entries are read without extraction. It is mutually exclusive with InDirectory.
+	InArchive    string
+	OutDirectory string
+	// S3 configures the object store of an s3://bucket/prefix InDirectory
+	S3 S3Config
+	// WriteTransactions writes the TransactionsFilename to the OutDirectory, listing the channels &
+	// frame numbers carried by each batcher transaction.
+	WriteTransactions bool
+	// WriteBlockFrames writes the BlockFramesFilename to the OutDirectory, listing the channels &
+	// frame numbers included in each L1 block.
+	WriteBlockFrames bool
+	// BatchOutDirectory receives a BatchSummary file per decoded batch, named by the channel ID &
+	// batch index, in addition to the channel output. No batch files are written if empty.
+	BatchOutDirectory string
+	// DumpPayloads receives the raw decompressed payload of each ready channel, named by the channel ID
+	// with the PayloadSuffix. Channels which fail to decompress are logged. No payloads are written if empty.
+	DumpPayloads  string
 	L2ChainID     *big.Int
 	L2GenesisTime uint64
 	L2BlockTime   uint64
+	// StartBlock & EndBlock bound the L1 inclusion blocks (both inclusive) of the loaded
+	// transactions. Zero means unbounded.
+	StartBlock uint64
+	EndBlock   uint64
+	// SinceTime & UntilTime bound the L1 inclusion block times (both inclusive) of the loaded
+	// transactions. The zero time means unbounded. Transactions without a block time are not filtered.
+	SinceTime time.Time
+	UntilTime time.Time
+	// OutputFormat is either OutputFormatJSON (default), OutputFormatCSV, OutputFormatNDJSON,
+	// OutputFormatParquet or OutputFormatGraph
+	OutputFormat string
+	// SortBy is the order in which channels are processed & listed in the index: SortByBlock (default),
+	// SortByFrameCount or SortByDataSize.
+	SortBy string
+	// ChannelTimeout is the number of L1 blocks after the open block in which frames of a channel
+	// may be included. Zero disables the timeout check, while the detection of reused channel IDs
+	// falls back to the channel timeout of the chain spec.
+	ChannelTimeout uint64
+	// Concurrency is the number of channels processed in parallel. Defaults to runtime.NumCPU().
+	Concurrency int
+	// Timeline adds the frame arrival timeline to each channel
+	Timeline bool
+	// SkipEmptyFrames excludes frames without data from the channels, so they do not count towards readiness
+	SkipEmptyFrames bool
+	// MaxFrameNumber truncates channels by dropping all frames with a higher frame number, e.g. to
+	// bisect decompression failures. Channels are not truncated if nil.
+	MaxFrameNumber *uint16
+	// FilenameTemplate is the text/template of the channel filenames inside the OutDirectory, executed
+	// with a ChannelFilenameData. It may contain subdirectories, but must stay inside the OutDirectory.
+	// A channel whose filename was already rendered for another channel fails to be written.
+	// Defaults to DefaultFilenameTemplate.
+	FilenameTemplate string
+	// MaxFramesPerChannel limits the number of frames accepted per channel, in inclusion order, to
+	// bound the memory used by malformed channels. Defaults to DefaultMaxFramesPerChannel if not positive.
+	MaxFramesPerChannel int
+	// MaxOutputBytes caps the total size of the written channels, measured by the bytes the writer
+	// produces for them. Channels stops with ErrOutputLimit before writing the channel which would
+	// exceed the limit. Channels written up to then remain valid. It requires the json or ndjson
+	// output format. Unlimited if not positive.
+	MaxOutputBytes int64
+	// MaxFrameSize is the maximum frame size of the batcher, including the frame overhead, which
+	// ChannelWithMetadata.FrameFillRatio relates to. The fill ratio is not computed if zero.
+	MaxFrameSize uint64
+	// FrameSizeBuckets are the upper bounds, inclusive, of the buckets of
+	// ChannelWithMetadata.FrameSizeHistogram. Frames larger than all bounds are counted in a final
+	// unbounded bucket. Defaults to DefaultFrameSizeBuckets if empty.
+	FrameSizeBuckets []uint64
+	// MaxRLPBytesPerChannel overrides the limit of the decompressed channel data, which the chain spec
+	// defines at the highest L1 block time of each channel. Batches past the limit are not decoded,
+	// like in derivation. The chain spec limit is used if zero.
+	MaxRLPBytesPerChannel uint64
+	// HexFrameData encodes the frame data in the output as 0x-prefixed hex instead of base64, to compare
+	// it with block explorers.
+	HexFrameData bool
+	// BatchTypesOnly skips decoding the batches of ready channels, which is the most expensive part of
+	// processing. Only the ChannelWithMetadata.PayloadBatchTypes are reported, while the Batches & all
+	// fields derived from them stay empty.
+	BatchTypesOnly bool
+	// LegacyBatches decodes the transactions included before the L1 genesis of the rollup as pre-Bedrock
+	// batches, which are written to LegacyBatchesFilename. Frames of pre-Bedrock transactions which cannot
+	// be decoded as legacy batches are skipped with SkipReasonPreBedrock. Not supported in Watch mode.
+	LegacyBatches bool
+	// GasModel prices the calldata of the batcher transactions, e.g. for ChannelWithMetadata.L1GasUsed.
+	// If empty, the model active on L1 at the inclusion block is used, see L1PragueTime.
+	GasModel GasModel
+	// L1PragueTime is the activation time of the Prague L1 upgrade, from which calldata is priced by
+	// GasModelEIP7623 if no GasModel is configured. Channels defaults it to the L1PragueTime of the L1
+	// chain of the rollup config, if known.
+	L1PragueTime uint64
+	// ZlibDictionary is the preset dictionary of zlib compressed channels, for batchers which compress
+	// with a shared dictionary. Standard zlib decompression is used if empty.
+	ZlibDictionary []byte
+	// ReadyOnly skips writing the channels which are not ready. They are still counted in the
+	// statistics & listed in the error manifest.
+	ReadyOnly bool
+	// SampleCount limits the written channels to a random sample of at most this many channels, selected
+	// by reservoir sampling. All channels are still counted in the statistics & listed in the error
+	// manifest. Channels updated by Watch are written regardless. Sampling is disabled if not positive.
+	SampleCount int
+	// SampleSeed seeds the sampling, so that runs over the same channels write the same sample
+	SampleSeed int64
+	// StrictReady additionally requires the data of ready channels to decompress. Complete channels
+	// whose data fails to decompress are then not ready, with NotReadyReasonDecompressionFailed.
+	// The channel bank Replay is not affected, as the derivation pipeline only decompresses later.
+	StrictReady bool
+	// Timing logs the wall-clock duration of each phase of Channels when it returns: loading, sorting,
+	// writing the reports, grouping, processing including writing & closing the output. The total
+	// duration of the concurrent channel writes is logged as well.
+	Timing bool
+	// ContinueOnError logs transaction files which fail to load & channels which fail to be written
+	// as warnings instead of returning them from Channels, so that isolated failures do not fail a run.
+	// Errors which affect the whole output, e.g. failing to create the out directory, are still returned.
+	ContinueOnError bool
+	// Watch keeps Channels running after the initial pass, to process the transaction files created in
+	// the InDirectory until the context is cancelled, which then ends Channels without an error.
+	// The channels of new frames are re-processed & their files rewritten. Channels which become ready
+	// are logged. The index & error manifest only reflect the initial pass.
+	// Watching requires a local InDirectory & the per-channel JSON output.
+	Watch bool
+	// Trace logs the decision taken for every frame of every channel: accepted, closing the channel
+	// or the reason the frame was skipped. It is very verbose & therefore disabled by default.
+	Trace bool
+	// VerifyChecksums verifies each file or s3:// object of the InDirectory against the checksum of its
+	// sidecar file (see ChecksumSuffix) before decoding it. Mismatching files are skipped & listed in
+	// the ChecksumErrorsFilename. Files without a sidecar file are not verified.
+	VerifyChecksums bool
+	// VerifyRoundTrip re-encodes the batches of ready channels & compares them with the channel payload
+	VerifyRoundTrip bool
+	// Replay additionally feeds the frames of each channel through the channel bank of the derivation
+	// pipeline & reports whether it agrees with the manual re-assembly. Unlike the manual re-assembly,
+	// the channel bank applies the channel timeout of the rollup config.
+	Replay bool
+	// PrettyPrint indents all JSON output for human readers. The output is compact by default.
+	PrettyPrint bool
+	// DryRun processes all channels & prints summary statistics to stdout without writing any files
+	DryRun bool
+	// StatsOnly processes all channels like a normal run, but only prints aggregate statistics to
+	// stdout instead of writing any files.
+	StatsOnly bool
+	// StatsJSON prints the statistics of DryRun & StatsOnly as JSON instead of a human readable summary
+	StatsJSON bool
+	// IncludeRawCalldata attaches the input of the carrying transaction to each frame.
+	// This considerably increases the output size.
+	IncludeRawCalldata bool
+	// Resume skips writing channel files which already exist in OutDirectory & hold a valid JSON
+	// document of the channel, so that interrupted runs can be restarted. Only applies to OutputFormatJSON.
+	Resume bool
+	// SingleFile is the path of a file to write all channels to as a single JSON array, instead of
+	// writing one file per channel to OutDirectory. With OutputFormatNDJSON, the channels are written
+	// to the file line by line instead. Not supported with OutputFormatCSV.
+	SingleFile string
+	// Output receives the channels of OutputFormatNDJSON & Stdout, taking precedence over the SingleFile,
+	// and the statistics of DryRun & StatsOnly. Defaults to stdout.
+	Output io.Writer
+	// Stdout writes the JSON of the channels to stdout, one channel per line, instead of creating any
+	// files. It is meant to pipe single channels selected by ChannelIDs into other tools. Only supported
+	// with OutputFormatJSON & OutputFormatNDJSON, and exclusive with the SingleFile.
+	Stdout bool
+	// ChannelIDs restricts processing to the listed channels. All channels are processed if empty.
+	ChannelIDs []derive.ChannelID
+	// Log receives diagnostics about the processed channels. Logs are discarded if nil.
+	Log log.Logger
+	// DirPerm & FilePerm are the permissions of the created out directory & output files, before
+	// the umask is applied. They default to 0750 & 0666.
+	DirPerm  os.FileMode
+	FilePerm os.FileMode
+	// ProgressFunc is called after each transaction file or object is loaded from InDirectory & after
+	// each channel is processed, with the done & total counts of the respective phase. Calls are
+	// never concurrent. Optional.
+	ProgressFunc func(done, total int)
+	// Metrics records each processed channel, e.g. the Prometheus counters of NewMetrics.
+	// Metrics are disabled if nil.
+	Metrics Metricer
+	// PostProcessors run in order on every processed channel before it is written. They may run
+	// concurrently for different channels. Optional.
+	PostProcessors []PostProcessor
+}
+
+// LoadFrames loads all frames from the transactions in the given directory.
+// Transaction files that cannot be decoded are skipped & their errors are joined into the
+// returned error, so the returned frames are usable even when the error is non-nil.
+func LoadFrames(ctx context.Context, directory string, inbox common.Address) ([]FrameWithMetadata, error) {
+	return loadFrames(ctx, Config{InDirectory: directory, BatchInboxes: []common.Address{inbox}})
 }
 
-func LoadFrames(directory string, inbox common.Address) []FrameWithMetadata {
-	txns := loadTransactions(directory, inbox)
-	// Sort first by block number then by transaction index inside the block number range.
-	// This is to match the order they are processed in derivation.
+func loadFrames(ctx context.Context, config Config) ([]FrameWithMetadata, error) {
+	txns, err := loadTransactions(ctx, config)
+	txns, _ = splitRejectedSenders(txns)
+	sortTransactions(txns)
+	return transactionsToFrames(txns, config), err
+}
+
+// sortTransactions sorts first by block number then by transaction index inside the block number range.
+// This is to match the order they are processed in derivation.
+func sortTransactions(txns []fetch.TransactionWithMetadata) {
 	sort.Slice(txns, func(i, j int) bool {
 		if txns[i].BlockNumber == txns[j].BlockNumber {
 			return txns[i].TxIndex < txns[j].TxIndex
@@ -56,73 +688,660 @@ func LoadFrames(directory string, inbox common.Address) []FrameWithMetadata {
 			return txns[i].BlockNumber < txns[j].BlockNumber
 		}
 	})
-	return transactionsToFrames(txns)
 }
 
 // Channels loads all transactions from the given input directory that are submitted to the
 // specified batch inbox and then re-assembles all channels & writes the re-assembled channels
-// to the out directory.
-func Channels(config Config, rollupCfg *rollup.Config) {
-	if err := os.MkdirAll(config.OutDirectory, 0750); err != nil {
-		log.Fatal(err)
+// to the out directory. Transactions of invalid senders are ignored & listed in a separate file.
+// Input files which fail to load are skipped and reported in the returned error after all
+// other channels have been written.
+// If the context is cancelled, Channels returns the context error. Channels written before the
+// cancellation are complete & remain valid.
+// The returned Result summarizes the processed channels. It is also returned alongside the errors of
+// channels which failed to write, but is empty if Channels fails before processing any channel.
+func Channels(ctx context.Context, config Config, rollupCfg *rollup.Config) (Result, error) {
+	config = config.withL1PragueTime(rollupCfg)
+	if _, err := channelOrder(config.SortBy); err != nil {
+		return Result{}, err
+	}
+	var watcher *fsnotify.Watcher
+	if config.Watch {
+		var err error
+		if watcher, err = newDirectoryWatcher(config); err != nil {
+			return Result{}, err
+		}
+		defer watcher.Close()
+	}
+	if config.usesOutDirectory() {
+		if err := os.MkdirAll(config.OutDirectory, config.dirPerm()); err != nil {
+			return Result{}, err
+		}
+	}
+	if config.usesBatchOutDirectory() {
+		if err := os.MkdirAll(config.BatchOutDirectory, config.dirPerm()); err != nil {
+			return Result{}, err
+		}
+	}
+	if config.usesPayloadDirectory() {
+		if err := os.MkdirAll(config.DumpPayloads, config.dirPerm()); err != nil {
+			return Result{}, err
+		}
+	}
+	timer := newPhaseTimer(config.Timing)
+	defer timer.log(config.logger())
+	txns, loadErr := loadTransactions(ctx, config)
+	timer.done("load")
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	if config.ContinueOnError {
+		for _, err := range unjoin(loadErr) {
+			config.logger().Warn("Skipped transaction file", "err", err)
+		}
+	}
+	txns, rejected := splitRejectedSenders(txns)
+	if len(rejected) > 0 {
+		config.logger().Warn("Ignored transactions of invalid senders", "count", len(rejected))
+	}
+	var legacyBatches []LegacyBatch
+	if config.LegacyBatches && rollupCfg != nil {
+		txns, legacyBatches = splitLegacyBatches(txns, rollupCfg)
+		for _, batch := range legacyBatches {
+			if batch.Error != "" {
+				config.logger().Warn("Failed to decode legacy batch", "tx_hash", batch.TxHash, "err", batch.Error)
+			}
+		}
+		config.logger().Info("Decoded legacy batches", "count", len(legacyBatches))
+	}
+	sortTransactions(txns)
+	timer.done("sort")
+	if config.usesOutDirectory() {
+		if err := writeJSON(path.Join(config.OutDirectory, RejectedSendersFilename), config.filePerm(), config.PrettyPrint, rejected); err != nil {
+			return Result{}, errors.Join(loadErr, fmt.Errorf("failed to write rejected senders: %w", err))
+		}
+		if config.LegacyBatches {
+			if err := writeJSON(path.Join(config.OutDirectory, LegacyBatchesFilename), config.filePerm(), config.PrettyPrint, legacyBatches); err != nil {
+				return Result{}, errors.Join(loadErr, fmt.Errorf("failed to write legacy batches: %w", err))
+			}
+		}
+		if config.WriteTransactions {
+			if err := writeJSON(path.Join(config.OutDirectory, TransactionsFilename), config.filePerm(), config.PrettyPrint, transactionEntries(txns)); err != nil {
+				return Result{}, errors.Join(loadErr, fmt.Errorf("failed to write transactions: %w", err))
+			}
+		}
+		if config.WriteBlockFrames {
+			if err := writeJSON(path.Join(config.OutDirectory, BlockFramesFilename), config.filePerm(), config.PrettyPrint, blockFramesEntries(txns)); err != nil {
+				return Result{}, errors.Join(loadErr, fmt.Errorf("failed to write block frames: %w", err))
+			}
+		}
+		if config.VerifyChecksums {
+			if err := writeJSON(path.Join(config.OutDirectory, ChecksumErrorsFilename), config.filePerm(), config.PrettyPrint, checksumErrors(loadErr)); err != nil {
+				return Result{}, errors.Join(loadErr, fmt.Errorf("failed to write checksum errors: %w", err))
+			}
+		}
+	}
+	cadence := submissionCadence(txns)
+	gaps := nonceGaps(txns)
+	for _, gap := range gaps {
+		config.logger().Warn("Batcher nonce gap", "sender", gap.Sender, "first_missing", gap.FirstMissing,
+			"last_missing", gap.LastMissing, "block_before", gap.BlockBefore, "block_after", gap.BlockAfter)
+	}
+	indexAnomalies := txIndexAnomalies(txns)
+	for _, anomaly := range indexAnomalies {
+		config.logger().Warn("Inconsistent transaction index", "block", anomaly.BlockNumber, "tx_index", anomaly.TxIndex,
+			"tx_hash", anomaly.TxHash, "prev_tx_hash", anomaly.PrevTxHash, "reason", anomaly.Reason)
+	}
+	timer.done("reports")
+	channels, invalidIDFrames := groupChannels(config, rollupCfg, txns)
+	timer.done("group")
+	if len(invalidIDFrames) > 0 {
+		config.logger().Warn("Ignored frames with a zero channel ID", "count", len(invalidIDFrames))
+	}
+	if config.usesOutDirectory() {
+		if err := writeJSON(path.Join(config.OutDirectory, InvalidChannelIDFramesFilename), config.filePerm(), config.PrettyPrint, invalidIDFrames); err != nil {
+			return Result{}, errors.Join(loadErr, fmt.Errorf("failed to write invalid channel ID frames: %w", err))
+		}
+	}
+	budget := &outputBudget{limit: config.MaxOutputBytes}
+	w, err := newChannelWriter(config, Stats{NonceGaps: gaps, TxIndexAnomalies: indexAnomalies, SubmissionCadence: cadence,
+		InvalidChannelIDFrames: len(invalidIDFrames)}, budget)
+	if err != nil {
+		return Result{}, errors.Join(loadErr, err)
+	}
+	var (
+		writeErrsLock sync.Mutex
+		writeErrs     error
+		ready         = make(map[channelKey]bool)
+		result        Result
+		manifest      ErrorManifest
+	)
+	writeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var sampled map[int]bool
+	if config.SampleCount > 0 {
+		sampled = sampleIndices(len(channels), config.SampleCount, config.SampleSeed)
+	}
+	processChannels(writeCtx, config, rollupCfg, channels, func(i int, ch ChannelWithMetadata) {
+		ch.unsampled = sampled != nil && !sampled[i]
+		var err error
+		timer.timeWrite(func() {
+			err = w.WriteChannel(ch)
+			if !errors.Is(err, ErrOutputLimit) {
+				err = errors.Join(err, writeChannelExtras(config, ch))
+			}
+		})
+		if errors.Is(err, ErrOutputLimit) {
+			cancel()
+			return
+		}
+		writeErrsLock.Lock()
+		defer writeErrsLock.Unlock()
+		if err != nil {
+			// Channels which failed to write are not part of the result
+			if config.ContinueOnError {
+				config.logger().Warn("Failed to write channel", "channel_id", ch.ID, "err", err)
+			} else {
+				writeErrs = errors.Join(writeErrs, fmt.Errorf("failed to write channel %v: %w", ch.ID.String(), err))
+			}
+			return
+		}
+		result.add(ch)
+		manifest.add(ch)
+		if watcher != nil {
+			ready[channelKey{ch.ID, ch.IDReuseIndex}] = ch.IsReady
+		}
+	})
+	timer.done("process")
+	// Always close the writer so output written before a cancellation remains valid
+	if err := w.Close(); err != nil {
+		writeErrs = errors.Join(writeErrs, err)
+	}
+	timer.done("close")
+	manifest.sort()
+	result.Errors = manifest.Channels
+	result.BytesWritten = w.BytesWritten()
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	if config.ContinueOnError {
+		// The skipped files were logged after loading
+		loadErr = nil
+	}
+	if budget.exceeded {
+		writeErrs = errors.Join(writeErrs, fmt.Errorf("%w of %d bytes after writing %d channels",
+			ErrOutputLimit, budget.limit, budget.channels))
+	}
+	if watcher != nil {
+		cw, err := newChannelWatcher(config, rollupCfg, channels, ready)
+		if err != nil {
+			return result, errors.Join(loadErr, writeErrs, err)
+		}
+		cw.run(ctx, watcher)
+	}
+	return result, errors.Join(loadErr, writeErrs)
+}
+
+// writeChannelExtras writes the batch & payload files of the channel, if configured.
+// Nothing is written for channels which are not sampled.
+func writeChannelExtras(config Config, ch ChannelWithMetadata) error {
+	if ch.unsampled {
+		return nil
+	}
+	var err error
+	if config.usesBatchOutDirectory() {
+		err = errors.Join(err, writeBatchFiles(config.BatchOutDirectory, config.filePerm(), config.PrettyPrint, ch))
+	}
+	if config.usesPayloadDirectory() {
+		err = errors.Join(err, writePayloadFile(config, ch))
+	}
+	return err
+}
+
+// unjoin returns the errors of a joined error, or the error itself if it is not joined.
+func unjoin(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+// ReassembleChannels re-assembles & processes all channels of the given transactions in memory,
+// without touching the file system. The transactions are not filtered by inbox, sender or block range.
+// The channels are returned in the order of Config.SortBy, falling back to SortByBlock for unknown values.
+func ReassembleChannels(txns []fetch.TransactionWithMetadata, config Config, rollupCfg *rollup.Config) []ChannelWithMetadata {
+	config = config.withL1PragueTime(rollupCfg)
+	channels, _ := groupChannels(config, rollupCfg, slices.Clone(txns))
+	out := make([]ChannelWithMetadata, len(channels))
+	// Every channel is written to its own slot, so no locking is required
+	processChannels(context.Background(), config, rollupCfg, channels, func(i int, ch ChannelWithMetadata) {
+		out[i] = ch
+	})
+	return out
+}
+
+// channelFrames are all frames of a single channel, in inclusion order.
+type channelFrames struct {
+	id     derive.ChannelID
+	frames []FrameWithMetadata
+	// reused & reuseIndex are set if the ID was reused, see ChannelWithMetadata.IDReused
+	reused     bool
+	reuseIndex int
+}
+
+// groupChannels sorts the transactions & groups their frames by channel, skipping the frames of
+// channels not selected by config.ChannelIDs. Frames with a zero channel ID are returned separately.
+// Frames of a reused channel ID are split into distinct channels, see splitReusedChannel.
+// The channels are ordered by config.SortBy, so that processing & logging is reproducible between runs.
+//
+// Each transaction is released from txns as soon as its frames are grouped, so that the calldata
+// of all transactions is not held in memory next to the frames. The caller must not use txns afterwards.
+func groupChannels(config Config, rollupCfg *rollup.Config, txns []fetch.TransactionWithMetadata) ([]channelFrames, []InvalidChannelIDFrame) {
+	sortTransactions(txns)
+	selected := make(map[derive.ChannelID]struct{}, len(config.ChannelIDs))
+	for _, id := range config.ChannelIDs {
+		selected[id] = struct{}{}
 	}
-	frames := LoadFrames(config.InDirectory, config.BatchInbox)
 	framesByChannel := make(map[derive.ChannelID][]FrameWithMetadata)
-	for _, frame := range frames {
-		framesByChannel[frame.Frame.ID] = append(framesByChannel[frame.Frame.ID], frame)
+	var invalid []InvalidChannelIDFrame
+	for i := range txns {
+		for _, frame := range transactionFrames(txns[i], config) {
+			if frame.Frame.ID == (derive.ChannelID{}) {
+				invalid = append(invalid, InvalidChannelIDFrame{
+					TxHash:         frame.TxHash,
+					InclusionBlock: frame.InclusionBlock,
+					FrameNumber:    frame.Frame.FrameNumber,
+				})
+				continue
+			}
+			if _, ok := selected[frame.Frame.ID]; len(selected) > 0 && !ok {
+				continue
+			}
+			framesByChannel[frame.Frame.ID] = append(framesByChannel[frame.Frame.ID], frame)
+		}
+		txns[i] = fetch.TransactionWithMetadata{}
 	}
+	channels := make([]channelFrames, 0, len(framesByChannel))
 	for id, frames := range framesByChannel {
-		ch := ProcessFrames(config, rollupCfg, id, frames)
-		filename := path.Join(config.OutDirectory, fmt.Sprintf("%s.json", id.String()))
-		if err := writeChannel(ch, filename); err != nil {
-			log.Fatal(err)
+		segments := splitReusedChannel(frames, config.channelTimeout(rollupCfg, frames[0].Timestamp))
+		if len(segments) > 1 {
+			config.logger().Warn("Channel ID reused", "channel_id", id, "channels", len(segments))
 		}
+		for i, segment := range segments {
+			channels = append(channels, channelFrames{id: id, frames: segment, reused: len(segments) > 1, reuseIndex: i})
+		}
+	}
+	less, err := channelOrder(config.SortBy)
+	if err != nil {
+		// Channels rejects unknown orders upfront, so this only affects ReassembleChannels
+		less, _ = channelOrder(SortByBlock)
 	}
+	sort.Slice(channels, func(i, j int) bool {
+		return less(channels[i].orderKey(), channels[j].orderKey())
+	})
+	return channels, invalid
 }
 
-func writeChannel(ch ChannelWithMetadata, filename string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		log.Fatal(err)
+// splitReusedChannel splits the frames of a channel ID, in inclusion order, wherever consecutive frames
+// were included more than the channel timeout apart. No frame can be added to a channel that late, so
+// the ID must have been reused by another channel. Frames are not split if the timeout is zero.
+func splitReusedChannel(frames []FrameWithMetadata, channelTimeout uint64) [][]FrameWithMetadata {
+	if channelTimeout == 0 {
+		return [][]FrameWithMetadata{frames}
+	}
+	var segments [][]FrameWithMetadata
+	start := 0
+	for i := 1; i < len(frames); i++ {
+		if frames[i].InclusionBlock-frames[i-1].InclusionBlock > channelTimeout {
+			segments = append(segments, frames[start:i])
+			start = i
+		}
+	}
+	return append(segments, frames[start:])
+}
+
+// channelTimeout returns the ChannelTimeout, falling back to the channel timeout of the chain spec
+// at the L1 block time if it is zero.
+func (c Config) channelTimeout(rollupCfg *rollup.Config, l1Time uint64) uint64 {
+	if c.ChannelTimeout != 0 {
+		return c.ChannelTimeout
+	}
+	return rollup.NewChainSpec(rollupCfg).ChannelTimeout(l1Time)
+}
+
+// InvalidChannelIDFramesFilename is the name of the file listing the frames with a zero channel ID.
+const InvalidChannelIDFramesFilename = "invalid_channel_id_frames.json"
+
+// InvalidChannelIDFrame is a frame with a zero channel ID, which usually stems from corrupt calldata.
+// Such frames are not grouped into a channel.
+type InvalidChannelIDFrame struct {
+	TxHash         common.Hash `json:"transaction_hash"`
+	InclusionBlock uint64      `json:"inclusion_block"`
+	FrameNumber    uint16      `json:"frame_number"`
+}
+
+func (c channelFrames) orderKey() channelOrderKey {
+	return channelOrderKey{
+		id:         c.id,
+		firstBlock: c.frames[0].InclusionBlock,
+		frameCount: len(c.frames),
+		dataSize:   framesDataSize(c.frames),
+	}
+}
+
+// processChannels processes the channels concurrently, dispatching them in the given order.
+// Each processed channel is passed to emit together with its position in channels. emit must be
+// safe for concurrent use. No new channels are processed once the context is cancelled.
+func processChannels(ctx context.Context, config Config, rollupCfg *rollup.Config, channels []channelFrames, emit func(int, ChannelWithMetadata)) {
+	concurrency := config.Concurrency
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+	var (
+		progressLock sync.Mutex
+		done         int
+	)
+	m := config.metrics()
+	var g errgroup.Group
+	g.SetLimit(concurrency)
+	for i, ch := range channels {
+		if ctx.Err() != nil {
+			break
+		}
+		g.Go(func() error {
+			processed := ProcessFrames(config, rollupCfg, ch.id, ch.frames)
+			processed.IDReused, processed.IDReuseIndex = ch.reused, ch.reuseIndex
+			postProcess(config, &processed)
+			m.RecordChannel(processed)
+			emit(i, processed)
+			progressLock.Lock()
+			defer progressLock.Unlock()
+			done++
+			config.progress(done, len(channels))
+			return nil
+		})
+	}
+	_ = g.Wait()
+}
+
+// postProcess runs the configured post-processors on the channel & records their errors.
+func postProcess(config Config, ch *ChannelWithMetadata) {
+	for _, p := range config.PostProcessors {
+		if err := p(ch); err != nil {
+			config.logger().Warn("Channel post-processor failed", "channel_id", ch.ID, "err", err)
+			ch.PostProcessErrors = append(ch.PostProcessErrors, err.Error())
+		}
 	}
-	defer file.Close()
-	enc := json.NewEncoder(file)
-	return enc.Encode(ch)
 }
 
 // ProcessFrames processes the frames for a given channel and reads batches and other relevant metadata
 // from the channel. Returns a ChannelWithMetadata struct containing all the relevant data.
 func ProcessFrames(cfg Config, rollupCfg *rollup.Config, id derive.ChannelID, frames []FrameWithMetadata) ChannelWithMetadata {
 	spec := rollup.NewChainSpec(rollupCfg)
+	lgr := cfg.logger().New("channel_id", id)
+	// Frames are added in L1 inclusion order, like in derivation. This makes the channel keep
+	// the earliest included of duplicate frames, regardless of the order frames were passed in.
+	frames = slices.Clone(frames)
+	if cfg.HexFrameData {
+		for i := range frames {
+			frames[i].hexData = true
+		}
+	}
+	sort.SliceStable(frames, func(i, j int) bool {
+		a, b := frames[i], frames[j]
+		if a.InclusionBlock != b.InclusionBlock {
+			return a.InclusionBlock < b.InclusionBlock
+		}
+		return a.TxIndex < b.TxIndex
+	})
 	ch := derive.NewChannel(id, eth.L1BlockRef{Number: frames[0].InclusionBlock})
 	invalidFrame := false
+	// trace logs the decision taken for a frame if Config.Trace is enabled
+	trace := func(frame FrameWithMetadata, decision string) {
+		if cfg.Trace {
+			lgr.Info("Frame decision", "frame_number", frame.Frame.FrameNumber, "is_last", frame.Frame.IsLast,
+				"inclusion_block", frame.InclusionBlock, "tx_hash", frame.TxHash, "decision", decision)
+		}
+	}
+	var skippedFrames []SkippedFrame
+	skip := func(frame FrameWithMetadata, reason string) {
+		trace(frame, reason)
+		skippedFrames = append(skippedFrames, SkippedFrame{frame, reason})
+	}
+	overLimit := false
+	if limit := cfg.maxFramesPerChannel(); len(frames) > limit {
+		lgr.Warn("Channel exceeds the frame limit", "frames", len(frames), "limit", limit)
+		overLimit = true
+		for _, frame := range frames[limit:] {
+			skip(frame, SkipReasonOverLimit)
+		}
+		frames = frames[:limit]
+	}
+	var compressedSize uint64
+	// framesByNumber mirrors the frames buffered by the channel
+	framesByNumber := make(map[uint16]FrameWithMetadata)
+	var endFrameNumber uint16
+	closed := false
+	// lateFrames are the frames accepted after the closing frame
+	var lateFrames []FrameWithMetadata
+	var conflictingFrames []ConflictingFrame
+	var closingFrame FrameWithMetadata
 
+	var emptyFrames []FrameWithMetadata
 	for _, frame := range frames {
+		if len(frame.Frame.Data) == 0 {
+			emptyFrames = append(emptyFrames, frame)
+		}
+	}
+
+	// input are the frames which are added to the channel
+	input := make([]FrameWithMetadata, 0, len(frames))
+	truncated := false
+	var truncatedFrames []FrameWithMetadata
+	for _, frame := range frames {
+		if cfg.LegacyBatches && frame.InclusionBlock < rollupCfg.Genesis.L1.Number {
+			// Bedrock channel framing does not apply before the rollup genesis
+			lgr.Warn("Skipping frame included before Bedrock", "inclusion_block", frame.InclusionBlock, "tx_hash", frame.TxHash)
+			invalidFrame = true
+			skip(frame, SkipReasonPreBedrock)
+		} else if frame.DeclaredLen != nil && *frame.DeclaredLen != len(frame.Frame.Data) {
+			lgr.Warn("Skipping frame with truncated data", "frame_number", frame.Frame.FrameNumber,
+				"data_len", len(frame.Frame.Data), "declared_len", *frame.DeclaredLen, "tx_hash", frame.TxHash)
+			invalidFrame = true
+			truncatedFrames = append(truncatedFrames, frame)
+			skip(frame, SkipReasonTruncatedData)
+		} else if cfg.MaxFrameNumber != nil && frame.Frame.FrameNumber > *cfg.MaxFrameNumber {
+			truncated = true
+			skip(frame, SkipReasonTruncated)
+		} else {
+			input = append(input, frame)
+		}
+	}
+
+	for i, frame := range input {
 		if ch.IsReady() {
-			fmt.Printf("Channel %v is ready despite having more frames\n", id.String())
+			lgr.Warn("Channel is ready despite having more frames", "remaining_frames", len(input)-i)
 			invalidFrame = true
+			for _, frame := range input[i:] {
+				skip(frame, SkipReasonChannelReady)
+			}
 			break
 		}
-		if err := ch.AddFrame(frame.Frame, eth.L1BlockRef{Number: frame.InclusionBlock, Time: frame.Timestamp}); err != nil {
-			fmt.Printf("Error adding to channel %v. Err: %v\n", id.String(), err)
+		if cfg.SkipEmptyFrames && len(frame.Frame.Data) == 0 {
+			lgr.Warn("Skipping empty frame", "frame_number", frame.Frame.FrameNumber, "tx_hash", frame.TxHash)
+			invalidFrame = true
+			skip(frame, SkipReasonEmpty)
+		} else if kept, ok := framesByNumber[frame.Frame.FrameNumber]; ok && !sameFrameContent(kept.Frame, frame.Frame) {
+			lgr.Warn("Skipping conflicting frame, keeping earliest inclusion", "frame_number", frame.Frame.FrameNumber,
+				"tx_hash", frame.TxHash, "kept_tx_hash", kept.TxHash)
+			invalidFrame = true
+			conflictingFrames = append(conflictingFrames, ConflictingFrame{
+				FrameNumber:       frame.Frame.FrameNumber,
+				KeptTxHash:        kept.TxHash,
+				ConflictingTxHash: frame.TxHash,
+			})
+			skip(frame, SkipReasonConflicting)
+		} else if ok {
+			lgr.Warn("Skipping duplicate frame, keeping earliest inclusion", "frame_number", frame.Frame.FrameNumber,
+				"tx_hash", frame.TxHash, "kept_tx_hash", kept.TxHash)
 			invalidFrame = true
+			skip(frame, SkipReasonDuplicate)
+		} else if err := ch.AddFrame(frame.Frame, eth.L1BlockRef{Number: frame.InclusionBlock, Time: frame.Timestamp}); err != nil {
+			reason := rejectReason(frame.Frame, closed, endFrameNumber)
+			lgr.Warn("Error adding frame to channel", "frame_number", frame.Frame.FrameNumber,
+				"is_last", frame.Frame.IsLast, "tx_hash", frame.TxHash, "reason", reason, "err", err)
+			invalidFrame = true
+			skip(frame, reason)
+		} else {
+			compressedSize += uint64(len(frame.Frame.Data))
+			if frame.Frame.IsLast {
+				trace(frame, FrameDecisionClosed)
+			} else {
+				trace(frame, FrameDecisionAccepted)
+			}
+			if closed && frame.Frame.FrameNumber < endFrameNumber {
+				lateFrames = append(lateFrames, frame)
+			}
+			if frame.Frame.IsLast {
+				// The channel prunes all frames past the closing frame. Pruned frames are skipped, so that
+				// they are neither part of the channel data nor of the readiness check.
+				var pruned []FrameWithMetadata
+				for number, kept := range framesByNumber {
+					if number >= frame.Frame.FrameNumber {
+						pruned = append(pruned, kept)
+						delete(framesByNumber, number)
+					}
+				}
+				sort.Slice(pruned, func(i, j int) bool {
+					return pruned[i].Frame.FrameNumber < pruned[j].Frame.FrameNumber
+				})
+				for _, p := range pruned {
+					lgr.Warn("Pruning frame past the closing frame", "frame_number", p.Frame.FrameNumber,
+						"closing_frame_number", frame.Frame.FrameNumber, "tx_hash", p.TxHash)
+					invalidFrame = true
+					compressedSize -= uint64(len(p.Frame.Data))
+					skip(p, SkipReasonPrunedByClose)
+				}
+				endFrameNumber, closed = frame.Frame.FrameNumber, true
+				closingFrame = frame
+			}
+			framesByNumber[frame.Frame.FrameNumber] = frame
+		}
+	}
+
+	closingFrameCount := 0
+	if closed {
+		closingFrameCount++
+	}
+	for _, frame := range skippedFrames {
+		if frame.Frame.IsLast {
+			closingFrameCount++
+		}
+	}
+	if closingFrameCount > 1 {
+		lgr.Warn("Channel has multiple closing frames", "closing_frames", closingFrameCount)
+	}
+
+	var assembled []byte
+	assemblyGap := false
+	if closed {
+		assembled, assemblyGap = assembleFrames(framesByNumber, endFrameNumber)
+	}
+	if ch.IsReady() != (closed && !assemblyGap) {
+		lgr.Error("Channel readiness does not match frame assembly", "is_ready", ch.IsReady(), "closed", closed, "assembly_gap", assemblyGap)
+	}
+	// rlpLimit bounds the decompressed channel data, like in derivation
+	rlpLimit := cfg.MaxRLPBytesPerChannel
+	if rlpLimit == 0 {
+		rlpLimit = spec.MaxRLPBytesPerChannel(ch.HighestBlock().Time)
+	}
+	var truncatedPrefix *TruncatedPrefix
+	if truncated {
+		lgr.Info("Channel is truncated", "max_frame_number", *cfg.MaxFrameNumber)
+		if !ch.IsReady() {
+			truncatedPrefix = decompressPrefix(framesByNumber, *cfg.MaxFrameNumber, cfg.ZlibDictionary, rlpLimit)
+		}
+	}
+
+	openBlock := ch.OpenBlockNumber()
+	var timeoutBlock uint64
+	timedOut := false
+	if cfg.ChannelTimeout != 0 {
+		timeoutBlock = openBlock + cfg.ChannelTimeout
+		if ch.HighestBlock().Number > timeoutBlock {
+			lgr.Warn("Channel timed out", "open_block", openBlock, "timeout_block", timeoutBlock,
+				"highest_block", ch.HighestBlock().Number)
+			timedOut = true
+		}
+	}
+	isReady := ch.IsReady() && !timedOut
+
+	var replay *ReplayResult
+	if cfg.Replay {
+		replay = newReplayResult(isReady, assembled, replayChannel(rollupCfg, frames))
+		if !replay.Agrees {
+			lgr.Warn("Channel bank replay disagrees", "is_ready", isReady, "replay_ready", replay.Ready)
 		}
 	}
 
 	var (
-		batches    []derive.Batch
-		batchTypes []int
-		comprAlgos []derive.CompressionAlgo
+		batches           []derive.Batch
+		batchTypes        []int
+		comprAlgos        []derive.CompressionAlgo
+		spanBatchBlocks   []SpanBatchBlock
+		decodeError       error
+		decompressed      []byte
+		payloadBatchTypes []int
+		compressionType   = CompressionTypeUnknown
 	)
 
 	invalidBatches := false
-	if ch.IsReady() {
-		br, err := derive.BatchReader(ch.Reader(), spec.MaxRLPBytesPerChannel(ch.HighestBlock().Time), rollupCfg.IsFjord(ch.HighestBlock().Time))
-		if err == nil {
+	var (
+		maxRLPBytes uint64
+		oversized   bool
+	)
+	if isReady {
+		// Frames pruned by a closing frame are not part of the channel data, so it is never larger
+		// than the assembled frames. One more byte is read to detect a mismatch.
+		payload, err := io.ReadAll(io.LimitReader(ch.Reader(), int64(len(assembled))+1))
+		if err != nil {
+			lgr.Error("Error reading channel data", "err", err)
+			decodeError = err
+		}
+		compressedSize = uint64(len(payload))
+		if !bytes.Equal(payload, assembled) {
+			lgr.Error("Assembled frame data does not match channel data", "assembled_size", len(assembled), "channel_size", len(payload))
+		}
+		if algo := detectCompression(payload); algo != "" {
+			compressionType = string(algo)
+		}
+		if data, _, err := decompressChannel(payload, cfg.ZlibDictionary, rlpLimit); err != nil {
+			lgr.Warn("Error decompressing channel", "err", err)
+		} else {
+			decompressed = data
+			if payloadBatchTypes, err = readPayloadBatchTypes(decompressed); err != nil {
+				lgr.Warn("Error reading batch types", "err", err)
+			}
+		}
+
+		maxRLPBytes = rlpLimit
+		if decompressed != nil && uint64(len(decompressed)) > maxRLPBytes {
+			lgr.Warn("Channel exceeds the max RLP bytes per channel, dropping the batches past the limit",
+				"decompressed_size", len(decompressed), "max_rlp_bytes", maxRLPBytes)
+			oversized = true
+		}
+		if cfg.BatchTypesOnly {
+			// Only the PayloadBatchTypes are reported
+		} else if br, err := batchReader(ch.Reader(), maxRLPBytes, rollupCfg.IsFjord(ch.HighestBlock().Time), cfg.ZlibDictionary); err == nil {
 			for batchData, err := br(); err != io.EOF; batchData, err = br() {
 				if err != nil {
-					fmt.Printf("Error reading batchData for channel %v. Err: %v\n", id.String(), err)
+					lgr.Warn("Error reading batchData", "err", err)
 					invalidBatches = true
+					// The derivation pipeline drops the rest of the channel on a read error.
+					decodeError = err
+					break
 				} else {
 					comprAlgos = append(comprAlgos, batchData.ComprAlgo)
 					batchType := batchData.GetBatchType()
@@ -132,7 +1351,10 @@ func ProcessFrames(cfg Config, rollupCfg *rollup.Config, id derive.ChannelID, fr
 						singularBatch, err := derive.GetSingularBatch(batchData)
 						if err != nil {
 							invalidBatches = true
-							fmt.Printf("Error converting singularBatch from batchData for channel %v. Err: %v\n", id.String(), err)
+							if decodeError == nil {
+								decodeError = err
+							}
+							lgr.Warn("Error converting singularBatch from batchData", "err", err)
 						}
 						// singularBatch will be nil when errored
 						batches = append(batches, singularBatch)
@@ -140,78 +1362,539 @@ func ProcessFrames(cfg Config, rollupCfg *rollup.Config, id derive.ChannelID, fr
 						spanBatch, err := derive.DeriveSpanBatch(batchData, cfg.L2BlockTime, cfg.L2GenesisTime, cfg.L2ChainID)
 						if err != nil {
 							invalidBatches = true
-							fmt.Printf("Error deriving spanBatch from batchData for channel %v. Err: %v\n", id.String(), err)
+							if decodeError == nil {
+								decodeError = err
+							}
+							lgr.Warn("Error deriving spanBatch from batchData", "err", err)
+						} else {
+							spanBatchBlocks = append(spanBatchBlocks, spanBatchToBlocks(cfg, len(batches), spanBatch)...)
 						}
 						// spanBatch will be nil when errored
 						batches = append(batches, spanBatch)
 					default:
-						fmt.Printf("unrecognized batch type: %d for channel %v.\n", batchData.GetBatchType(), id.String())
+						lgr.Warn("Unrecognized batch type", "batch_type", batchData.GetBatchType())
 					}
 				}
 			}
 		} else {
-			fmt.Printf("Error creating batch reader for channel %v. Err: %v\n", id.String(), err)
+			decodeError = err
+			lgr.Warn("Error creating batch reader", "err", err)
 		}
 	} else {
-		fmt.Printf("Channel %v is not ready\n", id.String())
+		lgr.Info("Channel is not ready")
+	}
+
+	var notReadyReason string
+	switch {
+	case timedOut:
+		notReadyReason = NotReadyReasonTimedOut
+	case !closed:
+		notReadyReason = NotReadyReasonNotClosed
+	case !isReady:
+		notReadyReason = NotReadyReasonMissingFrames
+	case cfg.StrictReady && decompressed == nil:
+		lgr.Warn("Channel is complete, but not ready because its data failed to decompress")
+		isReady = false
+		notReadyReason = NotReadyReasonDecompressionFailed
+	}
+
+	// A channel which could still receive frames after the EndBlock is likely incomplete only because
+	// the loaded block range ends before the channel does.
+	likelyTruncatedByWindow := false
+	if cfg.EndBlock != 0 && (notReadyReason == NotReadyReasonNotClosed || notReadyReason == NotReadyReasonMissingFrames) {
+		likelyTruncatedByWindow = openBlock+cfg.channelTimeout(rollupCfg, frames[0].Timestamp) > cfg.EndBlock
+	}
+
+	var decodeErrorMsg string
+	if decodeError != nil {
+		decodeErrorMsg = decodeError.Error()
+	}
+
+	var timeline []FrameArrival
+	if cfg.Timeline {
+		timeline = frameTimeline(frames)
+	}
+
+	var (
+		derivedL2Blocks  []uint64
+		timestampAnomaly []int
+	)
+	if isReady && decodeError == nil && cfg.L2BlockTime != 0 {
+		derivedL2Blocks = deriveL2BlockNumbers(cfg, rollupCfg, batches)
+	}
+	if cfg.L2BlockTime != 0 {
+		if timestampAnomaly = timestampAnomalies(cfg.L2BlockTime, batches); len(timestampAnomaly) > 0 {
+			lgr.Warn("Batch timestamps are not spaced by the L2 block time", "batch_indices", timestampAnomaly)
+		}
+	}
+
+	inclusionBlocks := make(map[uint64]struct{})
+	txHashes := make(map[common.Hash]struct{})
+	var l1GasUsed uint64
+	for _, frame := range frames {
+		inclusionBlocks[frame.InclusionBlock] = struct{}{}
+		if _, ok := txHashes[frame.TxHash]; !ok {
+			txHashes[frame.TxHash] = struct{}{}
+			l1GasUsed += frame.CalldataGas
+		}
+	}
+
+	var (
+		roundTripMatch *bool
+		roundTripDiff  string
+	)
+	if cfg.VerifyRoundTrip && decompressed != nil && !invalidBatches {
+		match, diff := verifyRoundTrip(batches, decompressed)
+		if !match {
+			lgr.Warn("Re-encoded batches do not match the channel payload", "diff", diff)
+		}
+		roundTripMatch, roundTripDiff = &match, diff
+	}
+
+	// A channel whose highest frame number is the maximum frame number cannot hold any further frames
+	highest := highestFrameNumber(framesByNumber, closed, endFrameNumber)
+	if highest != nil && *highest == math.MaxUint16 {
+		lgr.Warn("Channel reached the maximum frame number")
+	}
+
+	// Over-limit frames are not part of frames, but still occupied L1 blocks
+	lastInclusionBlock := frames[len(frames)-1].InclusionBlock
+	for _, frame := range skippedFrames {
+		lastInclusionBlock = max(lastInclusionBlock, frame.InclusionBlock)
+	}
+
+	var compressionRatio float64
+	if len(decompressed) > 0 {
+		compressionRatio = float64(compressedSize) / float64(len(decompressed))
+	}
+
+	txCounts, txGas, totalL2Txns := batchTxCounts(batches)
+
+	var payload []byte
+	if cfg.DumpPayloads != "" {
+		payload = decompressed
+	}
+
+	avgFrameDataSize := averageFrameDataSize(framesByNumber)
+	var frameFillRatio float64
+	if cfg.MaxFrameSize > 0 && len(framesByNumber) > 0 {
+		frameFillRatio = (avgFrameDataSize + derive.FrameV0OverHeadSize) / float64(cfg.MaxFrameSize)
 	}
 
 	return ChannelWithMetadata{
-		ID:             id,
-		Frames:         frames,
-		IsReady:        ch.IsReady(),
-		InvalidFrames:  invalidFrame,
-		InvalidBatches: invalidBatches,
-		Batches:        batches,
-		BatchTypes:     batchTypes,
-		ComprAlgos:     comprAlgos,
+		SchemaVersion:           SchemaVersion,
+		ID:                      id,
+		Frames:                  frames,
+		SkippedFrames:           skippedFrames,
+		IsReady:                 isReady,
+		NotReadyReason:          notReadyReason,
+		InvalidFrames:           invalidFrame,
+		InvalidBatches:          invalidBatches,
+		Batches:                 batches,
+		BatchTypes:              batchTypes,
+		PayloadBatchTypes:       payloadBatchTypes,
+		ComprAlgos:              comprAlgos,
+		DecodeError:             decodeErrorMsg,
+		SpanBatchBlocks:         spanBatchBlocks,
+		BatchEpochs:             batchEpochs(batches),
+		BatchTxCounts:           txCounts,
+		BatchTxGas:              txGas,
+		TotalL2Txns:             totalL2Txns,
+		Replay:                  replay,
+		CompressedSize:          compressedSize,
+		AvgFrameDataSize:        avgFrameDataSize,
+		FrameFillRatio:          frameFillRatio,
+		FrameSizeHistogram:      frameSizeHistogram(cfg.FrameSizeBuckets, framesByNumber),
+		CompressionType:         compressionType,
+		Decompressed:            decompressed != nil,
+		DecompressedSize:        uint64(len(decompressed)),
+		OversizedChannel:        oversized,
+		MaxRLPBytes:             maxRLPBytes,
+		CompressionRatio:        compressionRatio,
+		OpenBlock:               openBlock,
+		TimeoutBlock:            timeoutBlock,
+		TimedOut:                timedOut,
+		LikelyTruncatedByWindow: likelyTruncatedByWindow,
+		AssembledSize:           uint64(len(assembled)),
+		AssemblyGap:             assemblyGap,
+		Closed:                  closed,
+		MissingFrameNumbers:     missingFrameNumbers(framesByNumber, closed, endFrameNumber),
+		HighestFrameNumber:      highest,
+		MaxFrameReached:         highest != nil && *highest == math.MaxUint16,
+		ClosingTxHash:           closingFrame.TxHash,
+		ClosingBlock:            closingFrame.InclusionBlock,
+		ClosingFrameCount:       closingFrameCount,
+		Timeline:                timeline,
+		DerivedL2Blocks:         derivedL2Blocks,
+		TimestampAnomaly:        timestampAnomaly,
+		EmptyFrames:             emptyFrames,
+		Truncated:               truncated,
+		TruncatedPrefix:         truncatedPrefix,
+		OverLimit:               overLimit,
+		LateFrames:              lateFrames,
+		ConflictingFrames:       conflictingFrames,
+		TruncatedFrames:         truncatedFrames,
+		MaxInclusionGap:         maxInclusionGap(framesByNumber),
+		InclusionBlocks:         len(inclusionBlocks),
+		FirstInclusionBlock:     frames[0].InclusionBlock,
+		LastInclusionBlock:      lastInclusionBlock,
+		BlockSpan:               lastInclusionBlock - frames[0].InclusionBlock,
+		L1GasUsed:               l1GasUsed,
+		RoundTripMatch:          roundTripMatch,
+		RoundTripDiff:           roundTripDiff,
+		payload:                 payload,
 	}
 }
 
-func transactionsToFrames(txns []fetch.TransactionWithMetadata) []FrameWithMetadata {
-	var out []FrameWithMetadata
-	for _, tx := range txns {
-		for _, frame := range tx.Frames {
-			fm := FrameWithMetadata{
-				TxHash:         tx.Tx.Hash(),
-				InclusionBlock: tx.BlockNumber,
-				BlockHash:      tx.BlockHash,
-				Timestamp:      tx.BlockTime,
-				Frame:          frame,
+// averageFrameDataSize returns the average data size of the accepted frames, or zero if there are none.
+func averageFrameDataSize(framesByNumber map[uint16]FrameWithMetadata) float64 {
+	if len(framesByNumber) == 0 {
+		return 0
+	}
+	var total int
+	for _, frame := range framesByNumber {
+		total += len(frame.Frame.Data)
+	}
+	return float64(total) / float64(len(framesByNumber))
+}
+
+// missingFrameNumbers lists the frame numbers without an accepted frame, up to endFrameNumber if the
+// channel is closed or up to the highest accepted frame number otherwise.
+func missingFrameNumbers(framesByNumber map[uint16]FrameWithMetadata, closed bool, endFrameNumber uint16) []uint16 {
+	highest := highestFrameNumber(framesByNumber, closed, endFrameNumber)
+	if highest == nil {
+		return nil
+	}
+	var missing []uint16
+	for number := 0; number <= int(*highest); number++ {
+		if _, ok := framesByNumber[uint16(number)]; !ok {
+			missing = append(missing, uint16(number))
+		}
+	}
+	return missing
+}
+
+// highestFrameNumber returns the closing frame number of a closed channel or the highest accepted
+// frame number of an open one, or nil if an open channel accepted no frames.
+func highestFrameNumber(framesByNumber map[uint16]FrameWithMetadata, closed bool, endFrameNumber uint16) *uint16 {
+	if closed {
+		return &endFrameNumber
+	}
+	if len(framesByNumber) == 0 {
+		return nil
+	}
+	var highest uint16
+	for number := range framesByNumber {
+		highest = max(highest, number)
+	}
+	return &highest
+}
+
+// maxInclusionGap returns the largest difference in inclusion blocks between frames with
+// consecutive frame numbers.
+func maxInclusionGap(framesByNumber map[uint16]FrameWithMetadata) uint64 {
+	numbers := make([]uint16, 0, len(framesByNumber))
+	for number := range framesByNumber {
+		numbers = append(numbers, number)
+	}
+	slices.Sort(numbers)
+	var maxGap uint64
+	for i := 1; i < len(numbers); i++ {
+		if numbers[i] != numbers[i-1]+1 {
+			continue
+		}
+		prev, cur := framesByNumber[numbers[i-1]], framesByNumber[numbers[i]]
+		// A later frame can be included before an earlier one
+		gap := max(prev.InclusionBlock, cur.InclusionBlock) - min(prev.InclusionBlock, cur.InclusionBlock)
+		maxGap = max(maxGap, gap)
+	}
+	return maxGap
+}
+
+// sameFrameContent returns true if both frames carry the same data & closing flag.
+func sameFrameContent(a, b derive.Frame) bool {
+	return a.IsLast == b.IsLast && bytes.Equal(a.Data, b.Data)
+}
+
+// rejectReason classifies why a channel in the given state rejected a non-duplicate frame.
+func rejectReason(frame derive.Frame, closed bool, endFrameNumber uint16) string {
+	switch {
+	case closed && frame.IsLast:
+		return SkipReasonChannelAlreadyClosed
+	case closed && frame.FrameNumber >= endFrameNumber:
+		return SkipReasonPastChannelEnd
+	default:
+		return SkipReasonRejected
+	}
+}
+
+// frameTimeline orders the frames by inclusion block, transaction hash & frame number.
+func frameTimeline(frames []FrameWithMetadata) []FrameArrival {
+	timeline := make([]FrameArrival, 0, len(frames))
+	for _, frame := range frames {
+		timeline = append(timeline, FrameArrival{
+			InclusionBlock: frame.InclusionBlock,
+			TxHash:         frame.TxHash,
+			FrameNumber:    frame.Frame.FrameNumber,
+		})
+	}
+	sort.SliceStable(timeline, func(i, j int) bool {
+		a, b := timeline[i], timeline[j]
+		if a.InclusionBlock != b.InclusionBlock {
+			return a.InclusionBlock < b.InclusionBlock
+		}
+		if c := bytes.Compare(a.TxHash[:], b.TxHash[:]); c != 0 {
+			return c < 0
+		}
+		return a.FrameNumber < b.FrameNumber
+	})
+	return timeline
+}
+
+// assembleFrames concatenates the data of the frames strictly in ascending frame number order,
+// from frame 0 up to and including endFrameNumber. Returns true if any frame in that range is missing.
+func assembleFrames(framesByNumber map[uint16]FrameWithMetadata, endFrameNumber uint16) ([]byte, bool) {
+	var data []byte
+	gap := false
+	for number := 0; number <= int(endFrameNumber); number++ {
+		frame, ok := framesByNumber[uint16(number)]
+		if !ok {
+			gap = true
+			continue
+		}
+		data = append(data, frame.Frame.Data...)
+	}
+	return data, gap
+}
+
+// decompressPrefix decompresses the contiguous frames from frame 0 up to maxFrameNumber, up to
+// the limit, see decompressChannel.
+func decompressPrefix(framesByNumber map[uint16]FrameWithMetadata, maxFrameNumber uint16, dict []byte, limit uint64) *TruncatedPrefix {
+	var (
+		prefix TruncatedPrefix
+		data   []byte
+	)
+	for number := 0; number <= int(maxFrameNumber); number++ {
+		frame, ok := framesByNumber[uint16(number)]
+		if !ok {
+			break
+		}
+		prefix.Frames++
+		data = append(data, frame.Frame.Data...)
+	}
+	prefix.Size = uint64(len(data))
+	decompressed, _, err := decompressChannel(data, dict, limit)
+	prefix.DecompressedSize = uint64(len(decompressed))
+	if err != nil {
+		prefix.DecompressError = err.Error()
+	}
+	return &prefix
+}
+
+// deriveL2BlockNumbers computes the L2 block numbers of the batches from their timestamps, the L2
+// genesis time & the L2 block time. Batches with a timestamp before the L2 genesis are skipped.
+func deriveL2BlockNumbers(cfg Config, rollupCfg *rollup.Config, batches []derive.Batch) []uint64 {
+	var out []uint64
+	add := func(timestamp uint64) {
+		if timestamp >= cfg.L2GenesisTime {
+			out = append(out, rollupCfg.Genesis.L2.Number+(timestamp-cfg.L2GenesisTime)/cfg.L2BlockTime)
+		}
+	}
+	for _, batch := range batches {
+		switch b := batch.(type) {
+		case *derive.SingularBatch:
+			add(b.Timestamp)
+		case *derive.SpanBatch:
+			for _, block := range b.Batches {
+				add(block.Timestamp)
 			}
-			out = append(out, fm)
 		}
 	}
 	return out
 }
 
-// if inbox is the zero address, it will load all frames
-func loadTransactions(dir string, inbox common.Address) []fetch.TransactionWithMetadata {
-	files, err := os.ReadDir(dir)
-	if err != nil {
-		log.Fatal(err)
+// timestampAnomalies returns the indices of the batches whose first block timestamp is not the last
+// block timestamp of the preceding batch plus the block time. The blocks of a span batch are spaced by
+// the block time by construction, so only the boundaries between batches are checked.
+// Batches which failed to decode are skipped & the batch after them is not checked.
+func timestampAnomalies(blockTime uint64, batches []derive.Batch) []int {
+	var (
+		out     []int
+		prev    uint64
+		hasPrev bool
+	)
+	for i, batch := range batches {
+		var first, last uint64
+		switch b := batch.(type) {
+		case *derive.SingularBatch:
+			if b == nil {
+				hasPrev = false
+				continue
+			}
+			first, last = b.Timestamp, b.Timestamp
+		case *derive.SpanBatch:
+			if b == nil || len(b.Batches) == 0 {
+				hasPrev = false
+				continue
+			}
+			first, last = b.Batches[0].Timestamp, b.Batches[len(b.Batches)-1].Timestamp
+		default:
+			hasPrev = false
+			continue
+		}
+		if hasPrev && first != prev+blockTime {
+			out = append(out, i)
+		}
+		prev, hasPrev = last, true
+	}
+	return out
+}
+
+// spanBatchToBlocks lists the L2 blocks of a derived span batch found at batchIndex in the channel.
+func spanBatchToBlocks(cfg Config, batchIndex int, spanBatch *derive.SpanBatch) []SpanBatchBlock {
+	var out []SpanBatchBlock
+	for _, block := range spanBatch.Batches {
+		out = append(out, SpanBatchBlock{
+			BatchIndex:   batchIndex,
+			Timestamp:    block.Timestamp,
+			RelTimestamp: block.Timestamp - cfg.L2GenesisTime,
+			L1Origin:     uint64(block.EpochNum),
+			TxCount:      len(block.Transactions),
+		})
+	}
+	return out
+}
+
+// transactionsToFrames lists the frames of all transactions. The raw transaction input is only
+// attached to the frames if Config.IncludeRawCalldata is set.
+func transactionsToFrames(txns []fetch.TransactionWithMetadata, config Config) []FrameWithMetadata {
+	var out []FrameWithMetadata
+	for _, tx := range txns {
+		out = append(out, transactionFrames(tx, config)...)
+	}
+	return out
+}
+
+// transactionFrames returns the frames of a single transaction together with their metadata.
+// The calldata gas is priced by the gas model of the config.
+func transactionFrames(tx fetch.TransactionWithMetadata, config Config) []FrameWithMetadata {
+	gas := config.gasModel(tx.BlockTime).calldataGas(tx.Tx.Data())
+	var calldata hexutil.Bytes
+	if config.IncludeRawCalldata {
+		calldata = tx.Tx.Data()
 	}
-	var out []fetch.TransactionWithMetadata
-	for _, file := range files {
-		f := path.Join(dir, file.Name())
-		txm := loadTransactionsFile(f)
-		if (inbox == common.Address{} || txm.InboxAddr == inbox) && txm.ValidSender {
-			out = append(out, txm)
+	declared := declaredFrameLengths(tx)
+	out := make([]FrameWithMetadata, 0, len(tx.Frames))
+	for _, frame := range tx.Frames {
+		var declaredLen *int
+		if n, ok := declared[frameKey{frame.ID, frame.FrameNumber}]; ok {
+			declaredLen = &n
 		}
+		out = append(out, FrameWithMetadata{
+			TxHash:         tx.Tx.Hash(),
+			InclusionBlock: tx.BlockNumber,
+			TxIndex:        tx.TxIndex,
+			InboxAddr:      tx.InboxAddr,
+			BlockHash:      tx.BlockHash,
+			Timestamp:      tx.BlockTime,
+			Frame:          frame,
+			Blob:           tx.Tx.Type() == types.BlobTxType,
+			DataLen:        len(frame.Data),
+			DeclaredLen:    declaredLen,
+			CalldataGas:    gas,
+			Calldata:       calldata,
+		})
 	}
 	return out
 }
 
-func loadTransactionsFile(file string) fetch.TransactionWithMetadata {
-	f, err := os.Open(file)
+type frameKey struct {
+	id     derive.ChannelID
+	number uint16
+}
+
+// declaredFrameLengths parses the calldata of the transaction & returns the data length declared in the
+// header of each frame. Blob transactions & transactions with unparsable calldata yield no lengths.
+// It is only called once per transaction, by transactionFrames, which keeps the lengths in DeclaredLen.
+func declaredFrameLengths(tx fetch.TransactionWithMetadata) map[frameKey]int {
+	if tx.Tx.Type() == types.BlobTxType {
+		return nil
+	}
+	frames, err := derive.ParseFrames(tx.Tx.Data())
 	if err != nil {
-		log.Fatal(err)
+		return nil
+	}
+	lengths := make(map[frameKey]int, len(frames))
+	for _, frame := range frames {
+		lengths[frameKey{frame.ID, frame.FrameNumber}] = len(frame.Data)
+	}
+	return lengths
+}
+
+// statsOnly returns true if only statistics are printed & no files are written.
+func (c Config) statsOnly() bool {
+	return c.DryRun || c.StatsOnly
+}
+
+// output returns the Output, falling back to stdout.
+func (c Config) output() io.Writer {
+	if c.Output != nil {
+		return c.Output
+	}
+	return os.Stdout
+}
+
+// usesOutDirectory returns true if files are written to the OutDirectory.
+func (c Config) usesOutDirectory() bool {
+	return !c.statsOnly() && !c.Stdout && c.SingleFile == "" && c.OutputFormat != OutputFormatNDJSON
+}
+
+// usesBatchOutDirectory returns true if the decoded batches are written to the BatchOutDirectory.
+func (c Config) usesBatchOutDirectory() bool {
+	return !c.statsOnly() && c.BatchOutDirectory != ""
+}
+
+func (c Config) usesPayloadDirectory() bool {
+	return !c.statsOnly() && c.DumpPayloads != ""
+}
+
+func (c Config) dirPerm() os.FileMode {
+	if c.DirPerm == 0 {
+		return 0750
+	}
+	return c.DirPerm
+}
+
+func (c Config) filePerm() os.FileMode {
+	if c.FilePerm == 0 {
+		return 0666
 	}
-	defer f.Close()
-	dec := json.NewDecoder(f)
-	var txm fetch.TransactionWithMetadata
-	if err := dec.Decode(&txm); err != nil {
-		log.Fatalf("Failed to decode %v. Err: %v\n", file, err)
+	return c.FilePerm
+}
+
+func (c Config) maxFramesPerChannel() int {
+	if c.MaxFramesPerChannel <= 0 {
+		return DefaultMaxFramesPerChannel
+	}
+	return c.MaxFramesPerChannel
+}
+
+func (c Config) metrics() Metricer {
+	if c.Metrics == nil {
+		return noopMetrics{}
+	}
+	return c.Metrics
+}
+
+func (c Config) progress(done, total int) {
+	if c.ProgressFunc != nil {
+		c.ProgressFunc(done, total)
+	}
+}
+
+func (c Config) logger() log.Logger {
+	if c.Log == nil {
+		return log.NewLogger(log.DiscardHandler())
 	}
-	return txm
+	return c.Log
 }
@@ -0,0 +1,2457 @@
+package reassemble
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/holiman/uint256"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+var testInbox = common.Address{0xff, 0x10}
+
+func testTransaction(nonce uint64, block uint64, index uint64, frames ...derive.Frame) fetch.TransactionWithMetadata {
+	return fetch.TransactionWithMetadata{
+		TxIndex:     index,
+		InboxAddr:   testInbox,
+		BlockNumber: block,
+		BlockHash:   common.Hash{byte(block)},
+		BlockTime:   block * 12,
+		ValidSender: true,
+		Frames:      frames,
+		Tx: types.NewTx(&types.DynamicFeeTx{
+			ChainID:   big.NewInt(1),
+			Nonce:     nonce,
+			GasTipCap: big.NewInt(1),
+			GasFeeCap: big.NewInt(1),
+			To:        &testInbox,
+		}),
+	}
+}
+
+// testChannelFrames zlib-compresses the given batches into a channel and splits it into frames
+// carrying at most frameSize bytes of channel data each.
+func testChannelFrames(t *testing.T, id derive.ChannelID, frameSize int, batches ...derive.InnerBatchData) []derive.Frame {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	for _, batch := range batches {
+		require.NoError(t, rlp.Encode(zw, derive.NewBatchData(batch)))
+	}
+	require.NoError(t, zw.Close())
+	return splitFrames(id, buf.Bytes(), frameSize)
+}
+
+func splitFrames(id derive.ChannelID, data []byte, frameSize int) []derive.Frame {
+	var frames []derive.Frame
+	for i := 0; len(data) > 0; i++ {
+		n := min(frameSize, len(data))
+		frames = append(frames, derive.Frame{ID: id, FrameNumber: uint16(i), Data: data[:n]})
+		data = data[n:]
+	}
+	frames[len(frames)-1].IsLast = true
+	return frames
+}
+
+// testFrames wraps each frame in its own transaction, one per L1 block starting at block.
+func testFrames(block uint64, frames ...derive.Frame) []FrameWithMetadata {
+	var txns []fetch.TransactionWithMetadata
+	for i, frame := range frames {
+		txns = append(txns, testTransaction(uint64(i), block+uint64(i), 0, frame))
+	}
+	return transactionsToFrames(txns, Config{})
+}
+
+func writeTransaction(t *testing.T, dir string, txm fetch.TransactionWithMetadata) {
+	data, err := json.Marshal(txm)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path.Join(dir, txm.Tx.Hash().String()+".json"), data, 0644))
+}
+
+// runChannels runs Channels, discarding its Result.
+func runChannels(ctx context.Context, config Config, rollupCfg *rollup.Config) error {
+	_, err := Channels(ctx, config, rollupCfg)
+	return err
+}
+
+func TestLoadFramesSkipsCorruptFiles(t *testing.T) {
+	dir := t.TempDir()
+	id := derive.ChannelID{0x01}
+	writeTransaction(t, dir, testTransaction(0, 10, 0, derive.Frame{ID: id, FrameNumber: 0, Data: []byte{0x01}}))
+	writeTransaction(t, dir, testTransaction(1, 11, 0, derive.Frame{ID: id, FrameNumber: 1, Data: []byte{0x02}, IsLast: true}))
+	require.NoError(t, os.WriteFile(path.Join(dir, "corrupt.json"), []byte("{not json"), 0644))
+
+	frames, err := LoadFrames(context.Background(), dir, testInbox)
+	require.ErrorContains(t, err, "corrupt.json")
+	require.Len(t, frames, 2)
+	require.Equal(t, uint16(0), frames[0].Frame.FrameNumber)
+	require.Equal(t, uint16(1), frames[1].Frame.FrameNumber)
+	require.Equal(t, 1, frames[0].DataLen)
+}
+
+func TestChannelsContinueOnError(t *testing.T) {
+	in := t.TempDir()
+	good, bad := derive.ChannelID{0x01, 0x01}, derive.ChannelID{0x01, 0x02}
+	writeTransaction(t, in, testTransaction(0, 10, 0, derive.Frame{ID: good, IsLast: true}))
+	writeTransaction(t, in, testTransaction(1, 11, 0, derive.Frame{ID: bad, IsLast: true}))
+	require.NoError(t, os.WriteFile(path.Join(in, "corrupt.json"), []byte("{not json"), 0644))
+	// The filename of the second channel escapes the out directory, so it fails to be written
+	template := "{{if eq .FirstInclusionBlock 11}}../{{end}}{{.Name}}.json"
+
+	out := t.TempDir()
+	_, err := Channels(context.Background(), Config{InDirectory: in, OutDirectory: out, FilenameTemplate: template}, &rollup.Config{})
+	require.ErrorContains(t, err, "corrupt.json")
+	require.ErrorContains(t, err, "failed to write channel "+bad.String())
+
+	out = t.TempDir()
+	config := Config{InDirectory: in, OutDirectory: out, FilenameTemplate: template, ContinueOnError: true}
+	result, err := Channels(context.Background(), config, &rollup.Config{})
+	require.NoError(t, err)
+	_, err = os.Stat(path.Join(out, good.String()+".json"))
+	require.NoError(t, err)
+	// The channel which failed to write is not part of the result
+	require.Equal(t, 1, result.Channels)
+	require.Equal(t, 1, result.ReadyChannels)
+}
+
+func TestChannelsWatch(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	id := derive.ChannelID{0x01, 0x03}
+	writeTransaction(t, in, testTransaction(0, 10, 0, derive.Frame{ID: id, Data: []byte{0x01}}))
+	readChannel := func() (isReady bool, frames int) {
+		data, err := os.ReadFile(path.Join(out, id.String()+".json"))
+		if err != nil {
+			return false, 0
+		}
+		var ch struct {
+			IsReady bool              `json:"is_ready"`
+			Frames  []json.RawMessage `json:"frames"`
+		}
+		if json.Unmarshal(data, &ch) != nil {
+			return false, 0
+		}
+		return ch.IsReady, len(ch.Frames)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lgr, logs := testlog.CaptureLogger(t, log.LevelInfo)
+	done := make(chan error)
+	go func() {
+		done <- runChannels(ctx, Config{InDirectory: in, OutDirectory: out, Watch: true, Log: lgr}, &rollup.Config{})
+	}()
+	require.Eventually(t, func() bool {
+		_, frames := readChannel()
+		return frames == 1 && logs.FindLog(testlog.NewMessageFilter("Watching for new transaction files")) != nil
+	}, 10*time.Second, 10*time.Millisecond)
+
+	writeTransaction(t, in, testTransaction(1, 11, 0, derive.Frame{ID: id, FrameNumber: 1, Data: []byte{0x02}, IsLast: true}))
+	require.Eventually(t, func() bool {
+		isReady, frames := readChannel()
+		return isReady && frames == 2
+	}, 10*time.Second, 10*time.Millisecond)
+	require.NotNil(t, logs.FindLog(testlog.NewMessageFilter("Channel became ready")))
+
+	cancel()
+	require.NoError(t, <-done)
+
+	_, err := Channels(context.Background(), Config{InDirectory: in, SingleFile: path.Join(out, "all.json"), Watch: true}, &rollup.Config{})
+	require.ErrorContains(t, err, "watch mode requires")
+}
+
+func TestChannelsTiming(t *testing.T) {
+	in := t.TempDir()
+	writeTransaction(t, in, testTransaction(0, 10, 0, derive.Frame{ID: derive.ChannelID{0x01, 0x04}, IsLast: true}))
+	lgr, logs := testlog.CaptureLogger(t, log.LevelInfo)
+
+	require.NoError(t, runChannels(context.Background(), Config{InDirectory: in, OutDirectory: t.TempDir(), Log: lgr}, &rollup.Config{}))
+	require.Nil(t, logs.FindLog(testlog.NewMessageFilter("Timing")))
+
+	require.NoError(t, runChannels(context.Background(), Config{InDirectory: in, OutDirectory: t.TempDir(), Log: lgr, Timing: true}, &rollup.Config{}))
+	record := logs.FindLog(testlog.NewMessageFilter("Timing"))
+	require.NotNil(t, record)
+	for _, phase := range []string{"load", "sort", "reports", "group", "process", "close", "total_write"} {
+		require.IsType(t, time.Duration(0), record.AttrValue(phase), phase)
+	}
+}
+
+func TestChannelsCancelled(t *testing.T) {
+	dir := t.TempDir()
+	writeTransaction(t, dir, testTransaction(0, 10, 0, derive.Frame{ID: derive.ChannelID{0x01}, IsLast: true}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := Channels(ctx, Config{InDirectory: dir, OutDirectory: t.TempDir()}, nil)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestProcessFramesDecodesBatches(t *testing.T) {
+	id := derive.ChannelID{0x02}
+	batch := &derive.SingularBatch{
+		ParentHash: common.Hash{0xaa},
+		EpochNum:   7,
+		EpochHash:  common.Hash{0xbb},
+		Timestamp:  1000,
+	}
+	frames := testFrames(10, testChannelFrames(t, id, 8, batch)...)
+
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.True(t, ch.IsReady)
+	require.False(t, ch.InvalidBatches)
+	require.Empty(t, ch.DecodeError)
+	require.Equal(t, []int{derive.SingularBatchType}, ch.PayloadBatchTypes)
+	require.Len(t, ch.Batches, 1)
+	decoded, ok := ch.Batches[0].AsSingularBatch()
+	require.True(t, ok)
+	require.Equal(t, []BatchEpoch{{EpochNum: 7, LastEpochNum: 7, EpochHash: &batch.EpochHash}}, ch.BatchEpochs)
+	require.Equal(t, batch.ParentHash, decoded.ParentHash)
+	require.Equal(t, batch.EpochNum, decoded.EpochNum)
+	require.Equal(t, batch.Timestamp, decoded.Timestamp)
+
+	// The batch types are still read if the batches are not decoded
+	ch = ProcessFrames(Config{BatchTypesOnly: true}, &rollup.Config{}, id, frames)
+	require.True(t, ch.IsReady)
+	require.Equal(t, []int{derive.SingularBatchType}, ch.PayloadBatchTypes)
+	require.Empty(t, ch.Batches)
+	require.Empty(t, ch.BatchTypes)
+}
+
+func TestProcessFramesDecodeError(t *testing.T) {
+	id := derive.ChannelID{0x03}
+	frames := testFrames(10, splitFrames(id, []byte{0x78, 0x9c, 0xde, 0xad}, 2)...)
+
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.True(t, ch.IsReady)
+	require.True(t, ch.InvalidBatches)
+	require.NotEmpty(t, ch.DecodeError)
+}
+
+func TestProcessFramesSpanBatchBlocks(t *testing.T) {
+	id := derive.ChannelID{0x04}
+	cfg := Config{L2ChainID: big.NewInt(10), L2GenesisTime: 1000, L2BlockTime: 2}
+	spanBatch := derive.NewSpanBatch(cfg.L2GenesisTime, cfg.L2ChainID)
+	for i := uint64(0); i < 3; i++ {
+		require.NoError(t, spanBatch.AppendSingularBatch(&derive.SingularBatch{
+			EpochNum:  rollup.Epoch(5 + i/2),
+			Timestamp: cfg.L2GenesisTime + 10 + i*cfg.L2BlockTime,
+		}, i))
+	}
+	rawSpanBatch, err := spanBatch.ToRawSpanBatch()
+	require.NoError(t, err)
+	frames := testFrames(10, testChannelFrames(t, id, 16, rawSpanBatch)...)
+
+	ch := ProcessFrames(cfg, &rollup.Config{}, id, frames)
+	require.Empty(t, ch.DecodeError)
+	require.Equal(t, []int{derive.SpanBatchType}, ch.BatchTypes)
+	require.Len(t, ch.BatchEpochs, 1)
+	require.Equal(t, uint64(5), ch.BatchEpochs[0].EpochNum)
+	require.Equal(t, uint64(6), ch.BatchEpochs[0].LastEpochNum)
+	require.Nil(t, ch.BatchEpochs[0].EpochHash)
+	require.Equal(t, []int{0}, ch.BatchTxCounts)
+	require.Len(t, ch.SpanBatchBlocks, 3)
+	for i, block := range ch.SpanBatchBlocks {
+		require.Equal(t, 0, block.BatchIndex)
+		require.Equal(t, 10+uint64(i)*cfg.L2BlockTime, block.RelTimestamp)
+		require.Equal(t, 5+uint64(i)/2, block.L1Origin)
+	}
+}
+
+func TestProcessFramesL2TxCounts(t *testing.T) {
+	id := derive.ChannelID{0x14}
+	var txs []hexutil.Bytes
+	for _, gas := range []uint64{21_000, 50_000} {
+		tx, err := types.NewTx(&types.DynamicFeeTx{Gas: gas}).MarshalBinary()
+		require.NoError(t, err)
+		txs = append(txs, tx)
+	}
+	frames := testFrames(10, testChannelFrames(t, id, 1000,
+		&derive.SingularBatch{Timestamp: 1, Transactions: []hexutil.Bytes{{0x01}, {0x02}}},
+		&derive.SingularBatch{Timestamp: 2},
+		&derive.SingularBatch{Timestamp: 3, Transactions: txs},
+	)...)
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.Equal(t, []int{2, 0, 2}, ch.BatchTxCounts)
+	require.Equal(t, 4, ch.TotalL2Txns)
+	// Transactions which cannot be decoded do not count towards the gas
+	require.Equal(t, []uint64{0, 0, 71_000}, ch.BatchTxGas)
+}
+
+func TestBlockFramesEntries(t *testing.T) {
+	idA, idB := derive.ChannelID{0x18}, derive.ChannelID{0x19}
+	txns := []fetch.TransactionWithMetadata{
+		testTransaction(0, 10, 0, derive.Frame{ID: idA, FrameNumber: 3}),
+		testTransaction(1, 10, 1, derive.Frame{ID: idB, FrameNumber: 0}, derive.Frame{ID: idA, FrameNumber: 4}),
+		testTransaction(2, 11, 0),
+		testTransaction(3, 12, 0, derive.Frame{ID: idB, FrameNumber: 1}),
+	}
+	require.Equal(t, []BlockFramesEntry{
+		{BlockNumber: 10, MinFrameNumber: 0, MaxFrameNumber: 4, Frames: []TransactionFrame{
+			{ChannelID: idA, FrameNumber: 3}, {ChannelID: idB, FrameNumber: 0}, {ChannelID: idA, FrameNumber: 4},
+		}},
+		{BlockNumber: 12, MinFrameNumber: 1, MaxFrameNumber: 1, Frames: []TransactionFrame{{ChannelID: idB, FrameNumber: 1}}},
+	}, blockFramesEntries(txns))
+}
+
+func TestSubmissionCadence(t *testing.T) {
+	var txns []fetch.TransactionWithMetadata
+	for i, block := range []uint64{10, 10, 12, 15, 25} {
+		txns = append(txns, testTransaction(uint64(i), block, uint64(i), derive.Frame{ID: derive.ChannelID{0x16}}))
+	}
+	require.Nil(t, submissionCadence(txns[:1]))
+	require.Equal(t, &SubmissionCadence{Transactions: 5, MinGap: 0, MaxGap: 10, MeanGap: 3.75, MedianGap: 2.5}, submissionCadence(txns))
+	require.Equal(t, &SubmissionCadence{Transactions: 4, MinGap: 0, MaxGap: 3, MeanGap: 5.0 / 3, MedianGap: 2}, submissionCadence(txns[:4]))
+}
+
+func TestLoadTransactionsSenderFilter(t *testing.T) {
+	dir := t.TempDir()
+	senders := []common.Address{{0x0a}, {0x0b}, {0x0a}}
+	for i, sender := range senders {
+		txm := testTransaction(uint64(i), 10+uint64(i), 0, derive.Frame{ID: derive.ChannelID{0x17}, FrameNumber: uint16(i)})
+		txm.Sender = sender
+		writeTransaction(t, dir, txm)
+	}
+	txns, err := loadTransactions(context.Background(), Config{InDirectory: dir, SenderFilter: senders[0]})
+	require.NoError(t, err)
+	require.Len(t, txns, 2)
+	for _, txm := range txns {
+		require.Equal(t, senders[0], txm.Sender)
+	}
+
+	txns, err = loadTransactions(context.Background(), Config{InDirectory: dir})
+	require.NoError(t, err)
+	require.Len(t, txns, 3)
+}
+
+func TestLoadTransactionsBlockRange(t *testing.T) {
+	dir := t.TempDir()
+	for i := uint64(0); i < 5; i++ {
+		writeTransaction(t, dir, testTransaction(i, 10+i, 0))
+	}
+	txns, err := loadTransactions(context.Background(), Config{InDirectory: dir, StartBlock: 11, EndBlock: 13})
+	require.NoError(t, err)
+	require.Len(t, txns, 3)
+	for _, txm := range txns {
+		require.GreaterOrEqual(t, txm.BlockNumber, uint64(11))
+		require.LessOrEqual(t, txm.BlockNumber, uint64(13))
+	}
+
+	txns, err = loadTransactions(context.Background(), Config{InDirectory: dir, StartBlock: 12})
+	require.NoError(t, err)
+	require.Len(t, txns, 3)
+}
+
+func TestTransactionSourcesFilterWhileLoading(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	var lines []byte
+	for i := uint64(0); i < 4; i++ {
+		txm := testTransaction(i, 10+i, 0)
+		writeTransaction(t, a, txm)
+		data, err := json.Marshal(txm)
+		require.NoError(t, err)
+		lines = append(append(lines, data...), '\n')
+	}
+	// b overlaps a, so that the multi source sees its transactions twice
+	writeTransaction(t, b, testTransaction(3, 13, 0))
+	file := path.Join(t.TempDir(), "txs.ndjson")
+	require.NoError(t, os.WriteFile(file, lines, 0644))
+
+	for name, config := range map[string]Config{
+		"directory": {InDirectory: a},
+		"multi":     {InDirectory: a, InDirectories: []string{b}},
+		"ndjson":    {InFile: file},
+	} {
+		t.Run(name, func(t *testing.T) {
+			source, err := config.transactionSource()
+			require.NoError(t, err)
+			var seen []uint64
+			txns, err := source.Load(context.Background(), func(txm fetch.TransactionWithMetadata) bool {
+				seen = append(seen, txm.BlockNumber)
+				return txm.BlockNumber >= 12
+			})
+			require.NoError(t, err)
+			// Every transaction passes keep before it is returned, so those outside the range are never kept
+			require.Subset(t, seen, []uint64{10, 11, 12, 13})
+			require.Len(t, txns, 2)
+			for _, txm := range txns {
+				require.GreaterOrEqual(t, txm.BlockNumber, uint64(12))
+			}
+		})
+	}
+}
+
+func TestSampleIndices(t *testing.T) {
+	require.Len(t, sampleIndices(3, 5, 1), 3)
+	sample := sampleIndices(100, 10, 1)
+	require.Len(t, sample, 10)
+	require.Equal(t, sample, sampleIndices(100, 10, 1))
+	require.NotEqual(t, sample, sampleIndices(100, 10, 2))
+}
+
+func TestChannelsSample(t *testing.T) {
+	in := t.TempDir()
+	for i := byte(0); i < 10; i++ {
+		writeTransaction(t, in, testTransaction(uint64(i), 10+uint64(i), 0, derive.Frame{ID: derive.ChannelID{0x2b, i}, IsLast: true}))
+	}
+	written := func(seed int64) []string {
+		out := t.TempDir()
+		result, err := Channels(context.Background(), Config{InDirectory: in, OutDirectory: out, SampleCount: 3, SampleSeed: seed}, &rollup.Config{})
+		require.NoError(t, err)
+		require.Equal(t, 10, result.Channels)
+		var index Index
+		data, err := os.ReadFile(path.Join(out, IndexFilename))
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &index))
+		require.Equal(t, 10, index.Stats.Channels)
+		var files []string
+		for _, entry := range index.Channels {
+			require.FileExists(t, path.Join(out, entry.Filename))
+			files = append(files, entry.Filename)
+		}
+		require.Len(t, files, 3)
+		return files
+	}
+	require.Equal(t, written(7), written(7))
+}
+
+func TestChannelsGraphOutput(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	id := derive.ChannelID{0x29}
+	tx0 := testTransaction(0, 10, 0, derive.Frame{ID: id, Data: []byte{0x01}})
+	tx1 := testTransaction(1, 11, 0, derive.Frame{ID: id, FrameNumber: 1, IsLast: true}, derive.Frame{ID: id, FrameNumber: 1, IsLast: true})
+	writeTransaction(t, in, tx0)
+	writeTransaction(t, in, tx1)
+
+	require.NoError(t, runChannels(context.Background(), Config{InDirectory: in, OutDirectory: out, OutputFormat: OutputFormatGraph}, &rollup.Config{}))
+	data, err := os.ReadFile(path.Join(out, GraphFilename))
+	require.NoError(t, err)
+	graph := string(data)
+	require.True(t, strings.HasPrefix(graph, "digraph channels {\n"))
+	channel := fmt.Sprintf("%q", "channel "+id.String())
+	require.Contains(t, graph, channel+" [shape=box, color=green];")
+	require.Contains(t, graph, fmt.Sprintf("%q -> %s [label=\"#0 @10\", style=solid];", "tx "+tx0.Tx.Hash().String(), channel))
+	require.Contains(t, graph, fmt.Sprintf("%q -> %s [label=\"#1 @11\", style=dashed];", "tx "+tx1.Tx.Hash().String(), channel))
+	// Each transaction is a single node
+	require.Equal(t, 1, strings.Count(graph, fmt.Sprintf("%q [shape=ellipse", "tx "+tx1.Tx.Hash().String())))
+	require.FileExists(t, path.Join(out, ErrorsFilename))
+}
+
+func TestChannelsResult(t *testing.T) {
+	in := t.TempDir()
+	ready, open := derive.ChannelID{0x23}, derive.ChannelID{0x24}
+	writeTransaction(t, in, testTransaction(0, 10, 0, derive.Frame{ID: ready, IsLast: true, Data: []byte{0x01}},
+		derive.Frame{ID: ready, IsLast: true}))
+	writeTransaction(t, in, testTransaction(1, 11, 0, derive.Frame{ID: open, FrameNumber: 1, Data: []byte{0x02}}))
+
+	for _, config := range []Config{
+		{InDirectory: in, OutDirectory: t.TempDir()},
+		{InDirectory: in, OutDirectory: t.TempDir(), OutputFormat: OutputFormatCSV},
+		{InDirectory: in, SingleFile: path.Join(t.TempDir(), "all.json")},
+		{InDirectory: in, OutputFormat: OutputFormatNDJSON, Output: io.Discard},
+	} {
+		result, err := Channels(context.Background(), config, &rollup.Config{})
+		require.NoError(t, err)
+		require.Equal(t, 2, result.Channels)
+		require.Equal(t, 1, result.ReadyChannels)
+		require.Equal(t, 1, result.InvalidChannels)
+		require.Equal(t, 3, result.Frames)
+		require.Equal(t, 1, result.SkippedFrames)
+		require.Positive(t, result.BytesWritten)
+		require.Len(t, result.Errors, 2)
+		require.Equal(t, ready, result.Errors[0].ID)
+		require.Equal(t, open, result.Errors[1].ID)
+	}
+
+	var stats bytes.Buffer
+	result, err := Channels(context.Background(), Config{InDirectory: in, StatsOnly: true, Output: &stats}, &rollup.Config{})
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Channels)
+	require.Zero(t, result.BytesWritten)
+	// The statistics are printed to the Output instead of stdout
+	require.Contains(t, stats.String(), "Channels")
+}
+
+func TestChannelsWritesAllChannels(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	var ids []derive.ChannelID
+	for i := byte(0); i < 8; i++ {
+		id := derive.ChannelID{0x10, i}
+		ids = append(ids, id)
+		writeTransaction(t, in, testTransaction(uint64(i), 10+uint64(i), 0, derive.Frame{ID: id, IsLast: true, Data: []byte{i}}))
+	}
+	require.NoError(t, runChannels(context.Background(), Config{InDirectory: in, OutDirectory: out, Concurrency: 3}, &rollup.Config{}))
+	for _, id := range ids {
+		data, err := os.ReadFile(path.Join(out, id.String()+".json"))
+		require.NoError(t, err)
+		// Batches cannot be unmarshalled, so only decode the fields of interest.
+		var ch struct {
+			SchemaVersion string           `json:"schema_version"`
+			ID            derive.ChannelID `json:"id"`
+			IsReady       bool             `json:"is_ready"`
+		}
+		require.NoError(t, json.Unmarshal(data, &ch))
+		require.Equal(t, SchemaVersion, ch.SchemaVersion)
+		require.Equal(t, id, ch.ID)
+		require.True(t, ch.IsReady)
+	}
+
+	data, err := os.ReadFile(path.Join(out, IndexFilename))
+	require.NoError(t, err)
+	var index Index
+	require.NoError(t, json.Unmarshal(data, &index))
+	require.Equal(t, SchemaVersion, index.SchemaVersion)
+	require.Len(t, index.Channels, len(ids))
+	require.Equal(t, Stats{
+		Channels:        len(ids),
+		ReadyChannels:   len(ids),
+		Frames:          len(ids),
+		CompressedBytes: uint64(len(ids)),
+		// Only the data 0x01 decompresses, as an empty brotli stream
+		DecompressedChannels: 1,
+		ReadyRatio:           1,
+		AvgFramesPerChannel:  1,
+		SubmissionCadence:    &SubmissionCadence{Transactions: len(ids), MinGap: 1, MaxGap: 1, MeanGap: 1, MedianGap: 1},
+	}, index.Stats)
+	for i, entry := range index.Channels {
+		require.Equal(t, ids[i], entry.ID)
+		require.Equal(t, 10+uint64(i), entry.FirstInclusionBlock)
+		require.Equal(t, 1, entry.FrameCount)
+		require.Equal(t, ids[i].String()+".json", entry.Filename)
+	}
+}
+
+func TestChannelsMaxOutputBytes(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	var txns []fetch.TransactionWithMetadata
+	for i := byte(0); i < 4; i++ {
+		txm := testTransaction(uint64(i), 10+uint64(i), 0, derive.Frame{ID: derive.ChannelID{0x11, i}, IsLast: true, Data: []byte{i}})
+		txns = append(txns, txm)
+		writeTransaction(t, in, txm)
+	}
+	data, err := json.Marshal(ReassembleChannels(txns, Config{}, &rollup.Config{})[0])
+	require.NoError(t, err)
+	config := Config{InDirectory: in, OutDirectory: out, Concurrency: 1, MaxOutputBytes: int64(2*len(data) + len(data)/2)}
+
+	_, err = Channels(context.Background(), config, &rollup.Config{})
+	require.ErrorIs(t, err, ErrOutputLimit)
+	require.ErrorContains(t, err, "after writing 2 channels")
+	for i := byte(0); i < 4; i++ {
+		_, err := os.Stat(path.Join(out, derive.ChannelID{0x11, i}.String()+".json"))
+		if i < 2 {
+			require.NoError(t, err)
+		} else {
+			require.ErrorIs(t, err, os.ErrNotExist)
+		}
+	}
+	// The index of the written channels remains valid
+	data, err = os.ReadFile(path.Join(out, IndexFilename))
+	require.NoError(t, err)
+	var index Index
+	require.NoError(t, json.Unmarshal(data, &index))
+	require.Len(t, index.Channels, 2)
+}
+
+func TestChannelsMaxOutputBytesCountsWrittenBytes(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	var txns []fetch.TransactionWithMetadata
+	for i := byte(0); i < 4; i++ {
+		txm := testTransaction(uint64(i), 10+uint64(i), 0, derive.Frame{ID: derive.ChannelID{0x12, i}, IsLast: true, Data: []byte{i}})
+		txns = append(txns, txm)
+		writeTransaction(t, in, txm)
+	}
+	// Pretty printed files are larger than the compact encoding
+	data, err := json.MarshalIndent(ReassembleChannels(txns, Config{}, &rollup.Config{})[0], "", "  ")
+	require.NoError(t, err)
+	limit := int64(2*(len(data)+1) + len(data)/2)
+	config := Config{InDirectory: in, OutDirectory: out, Concurrency: 1, PrettyPrint: true, MaxOutputBytes: limit}
+
+	result, err := Channels(context.Background(), config, &rollup.Config{})
+	require.ErrorIs(t, err, ErrOutputLimit)
+	require.Equal(t, 2, result.Channels)
+	require.LessOrEqual(t, result.BytesWritten, limit)
+
+	// Resumed channels are not written again, so they do not consume the budget
+	require.NoError(t, runChannels(context.Background(), Config{InDirectory: in, OutDirectory: out}, &rollup.Config{}))
+	config = Config{InDirectory: in, OutDirectory: out, Resume: true, MaxOutputBytes: 1}
+	result, err = Channels(context.Background(), config, &rollup.Config{})
+	require.NoError(t, err)
+	require.Equal(t, 4, result.Channels)
+
+	// Formats whose output is not written per channel cannot enforce the limit
+	config = Config{InDirectory: in, OutDirectory: out, OutputFormat: OutputFormatCSV, MaxOutputBytes: limit}
+	_, err = Channels(context.Background(), config, &rollup.Config{})
+	require.ErrorContains(t, err, "max output bytes requires the json or ndjson output format")
+}
+
+func TestProcessFramesZlibDictionary(t *testing.T) {
+	id := derive.ChannelID{0x13}
+	dict := []byte("shared batcher dictionary")
+	var buf bytes.Buffer
+	zw, err := zlib.NewWriterLevelDict(&buf, zlib.BestCompression, dict)
+	require.NoError(t, err)
+	require.NoError(t, rlp.Encode(zw, derive.NewBatchData(&derive.SingularBatch{Timestamp: 7})))
+	require.NoError(t, zw.Close())
+	frames := testFrames(10, splitFrames(id, buf.Bytes(), 16)...)
+
+	// The stock decompressor cannot read the channel
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.True(t, ch.IsReady)
+	require.False(t, ch.Decompressed)
+	require.NotEmpty(t, ch.DecodeError)
+
+	ch = ProcessFrames(Config{ZlibDictionary: dict}, &rollup.Config{}, id, frames)
+	require.True(t, ch.Decompressed)
+	require.False(t, ch.InvalidBatches)
+	require.Empty(t, ch.DecodeError)
+	require.Len(t, ch.Batches, 1)
+	require.Equal(t, uint64(7), ch.Batches[0].(*derive.SingularBatch).Timestamp)
+}
+
+func TestProcessFramesStrictReady(t *testing.T) {
+	id := derive.ChannelID{0x1a}
+	corrupt := testFrames(10, derive.Frame{ID: id, Data: []byte{0x78, 0x01}, IsLast: true})
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, corrupt)
+	require.True(t, ch.IsReady)
+	require.Empty(t, ch.NotReadyReason)
+
+	ch = ProcessFrames(Config{StrictReady: true}, &rollup.Config{}, id, corrupt)
+	require.False(t, ch.IsReady)
+	require.Equal(t, NotReadyReasonDecompressionFailed, ch.NotReadyReason)
+
+	valid := testFrames(10, testChannelFrames(t, id, 1000, &derive.SingularBatch{})...)
+	ch = ProcessFrames(Config{StrictReady: true}, &rollup.Config{}, id, valid)
+	require.True(t, ch.IsReady)
+	require.Empty(t, ch.NotReadyReason)
+
+	// The reasons of channels which are not complete do not depend on StrictReady
+	open := testFrames(10, derive.Frame{ID: id, FrameNumber: 1})
+	require.Equal(t, NotReadyReasonNotClosed, ProcessFrames(Config{}, &rollup.Config{}, id, open).NotReadyReason)
+	gap := testFrames(10, derive.Frame{ID: id, FrameNumber: 1, IsLast: true})
+	require.Equal(t, NotReadyReasonMissingFrames, ProcessFrames(Config{}, &rollup.Config{}, id, gap).NotReadyReason)
+	late := testFrames(10, derive.Frame{ID: id}, derive.Frame{ID: id, FrameNumber: 1, IsLast: true})
+	late[1].InclusionBlock = 20
+	require.Equal(t, NotReadyReasonTimedOut, ProcessFrames(Config{ChannelTimeout: 5}, &rollup.Config{}, id, late).NotReadyReason)
+}
+
+func TestProcessFramesFrameFillRatio(t *testing.T) {
+	id := derive.ChannelID{0x12}
+	frames := []FrameWithMetadata{
+		{InclusionBlock: 10, Frame: derive.Frame{ID: id, FrameNumber: 0, Data: make([]byte, 100)}},
+		{InclusionBlock: 10, Frame: derive.Frame{ID: id, FrameNumber: 1, Data: make([]byte, 50)}},
+		// Skipped duplicates do not count
+		{InclusionBlock: 11, Frame: derive.Frame{ID: id, FrameNumber: 1, Data: make([]byte, 1000)}},
+	}
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.Equal(t, 75.0, ch.AvgFrameDataSize)
+	require.Zero(t, ch.FrameFillRatio)
+
+	ch = ProcessFrames(Config{MaxFrameSize: 196}, &rollup.Config{}, id, frames)
+	require.Equal(t, 75.0, ch.AvgFrameDataSize)
+	require.Equal(t, 0.5, ch.FrameFillRatio)
+}
+
+func TestProcessFramesFrameSizeHistogram(t *testing.T) {
+	id := derive.ChannelID{0x14}
+	frames := []FrameWithMetadata{
+		{InclusionBlock: 10, Frame: derive.Frame{ID: id, FrameNumber: 0, Data: make([]byte, 100)}},
+		{InclusionBlock: 10, Frame: derive.Frame{ID: id, FrameNumber: 1, Data: make([]byte, 100)}},
+		{InclusionBlock: 10, Frame: derive.Frame{ID: id, FrameNumber: 2, Data: make([]byte, 50)}},
+		{InclusionBlock: 10, Frame: derive.Frame{ID: id, FrameNumber: 3, Data: make([]byte, 101)}},
+		// Skipped duplicates do not count
+		{InclusionBlock: 11, Frame: derive.Frame{ID: id, FrameNumber: 3, Data: make([]byte, 1000)}},
+	}
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.Len(t, ch.FrameSizeHistogram, len(DefaultFrameSizeBuckets)+1)
+	require.Equal(t, 4, ch.FrameSizeHistogram[0].Count)
+
+	// The bounds are sorted & deduplicated, and include the upper bound
+	bound := func(n uint64) *uint64 { return &n }
+	ch = ProcessFrames(Config{FrameSizeBuckets: []uint64{100, 50, 100}}, &rollup.Config{}, id, frames)
+	require.Equal(t, []FrameSizeBucket{
+		{Min: 0, Max: bound(50), Count: 1},
+		{Min: 51, Max: bound(100), Count: 2},
+		{Min: 101, Count: 1},
+	}, ch.FrameSizeHistogram)
+
+	require.Nil(t, frameSizeHistogram(nil, nil))
+}
+
+func TestProcessFramesCompressionStats(t *testing.T) {
+	id := derive.ChannelID{0x05}
+	batch := &derive.SingularBatch{Transactions: []hexutil.Bytes{make([]byte, 1000)}}
+	channelFrames := testChannelFrames(t, id, 8, batch)
+	frames := testFrames(10, channelFrames...)
+
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	var compressedSize uint64
+	for _, frame := range channelFrames {
+		compressedSize += uint64(len(frame.Data))
+	}
+	require.True(t, ch.Decompressed)
+	require.Equal(t, compressedSize, ch.CompressedSize)
+	require.Greater(t, ch.DecompressedSize, uint64(1000))
+	require.Equal(t, float64(ch.CompressedSize)/float64(ch.DecompressedSize), ch.CompressionRatio)
+
+	// Without the closing frame the channel is not decompressed
+	ch = ProcessFrames(Config{}, &rollup.Config{}, id, frames[:len(frames)-1])
+	require.False(t, ch.Decompressed)
+	require.Zero(t, ch.DecompressedSize)
+	require.Equal(t, compressedSize-uint64(len(channelFrames[len(channelFrames)-1].Data)), ch.CompressedSize)
+}
+
+func TestChannelsCSVOutput(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	id := derive.ChannelID{0x06}
+	writeTransaction(t, in, testTransaction(0, 10, 0,
+		derive.Frame{ID: id, FrameNumber: 0, Data: []byte{0x01, 0x02}},
+		derive.Frame{ID: id, FrameNumber: 0, Data: []byte{0x01, 0x02}}))
+	writeTransaction(t, in, testTransaction(1, 11, 0, derive.Frame{ID: id, FrameNumber: 1, IsLast: true}))
+
+	require.NoError(t, runChannels(context.Background(), Config{InDirectory: in, OutDirectory: out, OutputFormat: OutputFormatCSV}, &rollup.Config{}))
+	require.NoFileExists(t, path.Join(out, id.String()+".json"))
+	f, err := os.Open(path.Join(out, FramesCSVFilename))
+	require.NoError(t, err)
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, [][]string{
+		{"channel_id", "frame_number", "is_last", "tx_hash", "inclusion_block", "frame_data_len", "skipped"},
+		{id.String(), "0", "false", records[1][3], "10", "2", "false"},
+		{id.String(), "0", "false", records[1][3], "10", "2", "true"},
+		{id.String(), "1", "true", records[3][3], "11", "0", "false"},
+	}, records)
+}
+
+func TestProcessFramesChannelTimeout(t *testing.T) {
+	id := derive.ChannelID{0x07}
+	frames := testFrames(10, testChannelFrames(t, id, 8, &derive.SingularBatch{})...)
+	lastBlock := frames[len(frames)-1].InclusionBlock
+
+	ch := ProcessFrames(Config{ChannelTimeout: lastBlock - 10}, &rollup.Config{}, id, frames)
+	require.True(t, ch.IsReady)
+	require.False(t, ch.TimedOut)
+	require.Equal(t, uint64(10), ch.OpenBlock)
+	require.Equal(t, lastBlock, ch.TimeoutBlock)
+
+	ch = ProcessFrames(Config{ChannelTimeout: lastBlock - 11}, &rollup.Config{}, id, frames)
+	require.False(t, ch.IsReady)
+	require.True(t, ch.TimedOut)
+	require.Equal(t, lastBlock-1, ch.TimeoutBlock)
+	require.Empty(t, ch.Batches)
+}
+
+func TestProcessFramesLikelyTruncatedByWindow(t *testing.T) {
+	id := derive.ChannelID{0x2c}
+	frames := testFrames(100, derive.Frame{ID: id, Data: []byte{0x01}})
+
+	ch := ProcessFrames(Config{EndBlock: 120, ChannelTimeout: 50}, &rollup.Config{}, id, frames)
+	require.False(t, ch.IsReady)
+	require.True(t, ch.LikelyTruncatedByWindow)
+
+	// The channel timed out before the end of the block range
+	ch = ProcessFrames(Config{EndBlock: 200, ChannelTimeout: 50}, &rollup.Config{}, id, frames)
+	require.False(t, ch.LikelyTruncatedByWindow)
+
+	// The chain spec channel timeout applies by default
+	ch = ProcessFrames(Config{EndBlock: 120}, &rollup.Config{ChannelTimeoutBedrock: 50}, id, frames)
+	require.True(t, ch.LikelyTruncatedByWindow)
+
+	ch = ProcessFrames(Config{ChannelTimeout: 50}, &rollup.Config{}, id, frames)
+	require.False(t, ch.LikelyTruncatedByWindow)
+
+	closed := testFrames(100, derive.Frame{ID: id, Data: []byte{0x01}, IsLast: true})
+	ch = ProcessFrames(Config{EndBlock: 120, ChannelTimeout: 50}, &rollup.Config{}, id, closed)
+	require.True(t, ch.IsReady)
+	require.False(t, ch.LikelyTruncatedByWindow)
+}
+
+func TestLoadTransactionsGzip(t *testing.T) {
+	dir := t.TempDir()
+	writeTransaction(t, dir, testTransaction(0, 10, 0, derive.Frame{ID: derive.ChannelID{0x08}, Data: []byte{0x01}}))
+	txm := testTransaction(1, 11, 0, derive.Frame{ID: derive.ChannelID{0x08}, FrameNumber: 1, IsLast: true})
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	require.NoError(t, json.NewEncoder(zw).Encode(txm))
+	require.NoError(t, zw.Close())
+	require.NoError(t, os.WriteFile(path.Join(dir, txm.Tx.Hash().String()+".json.gz"), buf.Bytes(), 0644))
+
+	txns, err := loadTransactions(context.Background(), Config{InDirectory: dir})
+	require.NoError(t, err)
+	require.Len(t, txns, 2)
+	require.Contains(t, []common.Hash{txns[0].Tx.Hash(), txns[1].Tx.Hash()}, txm.Tx.Hash())
+}
+
+func TestLoadTransactionsMultipleDirectories(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	shared := testTransaction(0, 10, 0, derive.Frame{ID: derive.ChannelID{0x25}, Data: []byte{0x01}})
+	writeTransaction(t, a, shared)
+	writeTransaction(t, b, shared)
+	writeTransaction(t, b, testTransaction(1, 11, 0, derive.Frame{ID: derive.ChannelID{0x25}, FrameNumber: 1, IsLast: true}))
+
+	txns, err := loadTransactions(context.Background(), Config{InDirectory: a, InDirectories: []string{b}})
+	require.NoError(t, err)
+	require.Len(t, txns, 2)
+
+	txns, err = loadTransactions(context.Background(), Config{InDirectories: []string{a, b, path.Join(b, "missing")}})
+	require.Error(t, err)
+	require.Len(t, txns, 2)
+}
+
+func TestLoadTransactionsArchive(t *testing.T) {
+	txm := testTransaction(0, 10, 0, derive.Frame{ID: derive.ChannelID{0x08}, IsLast: true})
+	data, err := json.Marshal(txm)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, entry := range []struct {
+		name string
+		data []byte
+	}{
+		{txm.Tx.Hash().String() + ".json", data},
+		{txm.Tx.Hash().String() + ".json" + ChecksumSuffix, []byte("ignored")},
+		{"corrupt.json", []byte("{")},
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.data))}))
+		_, err := tw.Write(entry.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+	archive := path.Join(t.TempDir(), "txns.tar.gz")
+	require.NoError(t, os.WriteFile(archive, buf.Bytes(), 0644))
+
+	logger, logs := testlog.CaptureLogger(t, log.LevelWarn)
+	txns, err := loadTransactions(context.Background(), Config{InArchive: archive, Log: logger})
+	require.ErrorContains(t, err, "skipped 1 malformed entries")
+	require.Len(t, txns, 1)
+	require.Equal(t, txm.Tx.Hash(), txns[0].Tx.Hash())
+	require.NotNil(t, logs.FindLog(testlog.NewMessageFilter("Skipping malformed archive entry")))
+
+	_, err = loadTransactions(context.Background(), Config{InArchive: archive, InDirectory: t.TempDir()})
+	require.ErrorContains(t, err, "mutually exclusive")
+}
+
+func TestChannelsDryRun(t *testing.T) {
+	in := t.TempDir()
+	out := path.Join(t.TempDir(), "out")
+	id := derive.ChannelID{0x09}
+	writeTransaction(t, in, testTransaction(0, 10, 0, derive.Frame{ID: id, IsLast: true}, derive.Frame{ID: id, IsLast: true}))
+
+	require.NoError(t, runChannels(context.Background(), Config{InDirectory: in, OutDirectory: out, DryRun: true}, &rollup.Config{}))
+	require.NoDirExists(t, out)
+}
+
+func TestStats(t *testing.T) {
+	var stats Stats
+	stats.add(ChannelWithMetadata{IsReady: true, Frames: make([]FrameWithMetadata, 2)})
+	stats.add(ChannelWithMetadata{InvalidFrames: true, Frames: make([]FrameWithMetadata, 3), SkippedFrames: []SkippedFrame{{Reason: SkipReasonDuplicate}}})
+	require.Equal(t, Stats{Channels: 2, ReadyChannels: 1, InvalidFrameChannels: 1, Frames: 5, SkippedFrames: 1, DuplicateFrames: 1}, stats)
+	require.Contains(t, stats.String(), "Skipped frames:                1\n")
+	require.Contains(t, stats.String(), "Duplicate frames:              1\n")
+
+	stats.add(ChannelWithMetadata{IsReady: true, Frames: make([]FrameWithMetadata, 1), Decompressed: true,
+		CompressedSize: 50, DecompressedSize: 100, CompressionRatio: 0.5})
+	stats.finalize()
+	require.InDelta(t, 2.0/3, stats.ReadyRatio, 1e-9)
+	require.Equal(t, 2.0, stats.AvgFramesPerChannel)
+	require.Equal(t, 0.5, stats.AvgCompressionRatio)
+	require.Equal(t, uint64(50), stats.CompressedBytes)
+	require.Contains(t, stats.String(), "Avg frames per channel:        2.00\n")
+}
+
+func TestProcessFramesAssembly(t *testing.T) {
+	id := derive.ChannelID{0x0a}
+	channelFrames := testChannelFrames(t, id, 4, &derive.SingularBatch{})
+	require.Greater(t, len(channelFrames), 2)
+	var size uint64
+	for _, frame := range channelFrames {
+		size += uint64(len(frame.Data))
+	}
+
+	// Submit frames in reverse order, assembly must still follow frame numbers
+	reversed := make([]derive.Frame, len(channelFrames))
+	for i, frame := range channelFrames {
+		reversed[len(channelFrames)-1-i] = frame
+	}
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, testFrames(10, reversed...))
+	require.True(t, ch.IsReady)
+	require.False(t, ch.AssemblyGap)
+	require.Equal(t, size, ch.AssembledSize)
+	require.Len(t, ch.Batches, 1)
+
+	// Drop frame 1
+	ch = ProcessFrames(Config{}, &rollup.Config{}, id, testFrames(10, append(channelFrames[:1:1], channelFrames[2:]...)...))
+	require.False(t, ch.IsReady)
+	require.True(t, ch.AssemblyGap)
+	require.Equal(t, size-uint64(len(channelFrames[1].Data)), ch.AssembledSize)
+}
+
+func TestProcessFramesClosingTransaction(t *testing.T) {
+	id := derive.ChannelID{0x0b}
+	frames := testFrames(10,
+		derive.Frame{ID: id, FrameNumber: 1, IsLast: true},
+		derive.Frame{ID: id, FrameNumber: 2, IsLast: true},
+		derive.Frame{ID: id, FrameNumber: 0})
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.Equal(t, frames[0].TxHash, ch.ClosingTxHash)
+	require.Equal(t, frames[0].InclusionBlock, ch.ClosingBlock)
+	require.Equal(t, []SkippedFrame{{frames[1], SkipReasonChannelAlreadyClosed}}, ch.SkippedFrames)
+	require.Equal(t, 2, ch.ClosingFrameCount)
+
+	ch = ProcessFrames(Config{}, &rollup.Config{}, id, []FrameWithMetadata{frames[0], frames[2]})
+	require.Equal(t, 1, ch.ClosingFrameCount)
+
+	ch = ProcessFrames(Config{}, &rollup.Config{}, id, frames[2:])
+	require.Equal(t, common.Hash{}, ch.ClosingTxHash)
+	require.Zero(t, ch.ClosingBlock)
+	require.Zero(t, ch.ClosingFrameCount)
+}
+
+func TestProcessFramesPrunedByClose(t *testing.T) {
+	id := derive.ChannelID{0x2a}
+	frames := []FrameWithMetadata{
+		testFrames(10, derive.Frame{ID: id, FrameNumber: 0, Data: []byte{0x01}})[0],
+		testFrames(11, derive.Frame{ID: id, FrameNumber: 3, Data: []byte{0x04}})[0],
+		testFrames(12, derive.Frame{ID: id, FrameNumber: 2, Data: []byte{0x03}})[0],
+		// The late closing frame prunes frames 2 & 3, which arrived earlier
+		testFrames(13, derive.Frame{ID: id, FrameNumber: 1, Data: []byte{0x02}, IsLast: true})[0],
+	}
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.True(t, ch.IsReady)
+	require.True(t, ch.Closed)
+	require.False(t, ch.AssemblyGap)
+	require.True(t, ch.InvalidFrames)
+	require.Equal(t, []SkippedFrame{{frames[2], SkipReasonPrunedByClose}, {frames[1], SkipReasonPrunedByClose}}, ch.SkippedFrames)
+	require.Empty(t, ch.MissingFrameNumbers)
+	require.Equal(t, uint16(1), *ch.HighestFrameNumber)
+	require.Equal(t, uint64(2), ch.CompressedSize)
+	require.Equal(t, uint64(2), ch.AssembledSize)
+
+	var stats Stats
+	stats.add(ch)
+	require.Equal(t, 2, stats.PrunedFrames)
+}
+
+func TestProcessFramesTimeline(t *testing.T) {
+	id := derive.ChannelID{0x0c}
+	tx := testTransaction(0, 10, 0, derive.Frame{ID: id, FrameNumber: 2, IsLast: true}, derive.Frame{ID: id, FrameNumber: 0})
+	frames := transactionsToFrames([]fetch.TransactionWithMetadata{tx, testTransaction(1, 9, 0, derive.Frame{ID: id, FrameNumber: 1})}, Config{})
+
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.Nil(t, ch.Timeline)
+
+	ch = ProcessFrames(Config{Timeline: true}, &rollup.Config{}, id, frames)
+	require.Equal(t, []FrameArrival{
+		{InclusionBlock: 9, TxHash: frames[2].TxHash, FrameNumber: 1},
+		{InclusionBlock: 10, TxHash: tx.Tx.Hash(), FrameNumber: 0},
+		{InclusionBlock: 10, TxHash: tx.Tx.Hash(), FrameNumber: 2},
+	}, ch.Timeline)
+}
+
+func TestLoadTransactionsNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	require.NoError(t, enc.Encode(testTransaction(0, 10, 0)))
+	buf.WriteString("{not json\n\n")
+	require.NoError(t, enc.Encode(testTransaction(1, 11, 0)))
+	file := path.Join(t.TempDir(), "txs.ndjson")
+	require.NoError(t, os.WriteFile(file, buf.Bytes(), 0644))
+
+	txns, err := loadTransactions(context.Background(), Config{InFile: file})
+	require.ErrorContains(t, err, "skipped 1 malformed lines")
+	require.Len(t, txns, 2)
+	require.Equal(t, uint64(10), txns[0].BlockNumber)
+	require.Equal(t, uint64(11), txns[1].BlockNumber)
+
+	_, err = loadTransactions(context.Background(), Config{InFile: file, InDirectory: t.TempDir()})
+	require.ErrorContains(t, err, "mutually exclusive")
+}
+
+func TestReassembleChannels(t *testing.T) {
+	idA, idB := derive.ChannelID{0x0d, 0x01}, derive.ChannelID{0x0d, 0x02}
+	txns := []fetch.TransactionWithMetadata{
+		testTransaction(1, 11, 0, derive.Frame{ID: idA, FrameNumber: 1, IsLast: true}),
+		testTransaction(0, 10, 0, derive.Frame{ID: idA, FrameNumber: 0}, derive.Frame{ID: idB, FrameNumber: 0}),
+	}
+	channels := ReassembleChannels(txns, Config{}, &rollup.Config{})
+	require.Len(t, channels, 2)
+	require.Equal(t, idA, channels[0].ID)
+	require.True(t, channels[0].IsReady)
+	require.Len(t, channels[0].Frames, 2)
+	require.Equal(t, uint64(10), channels[0].Frames[0].InclusionBlock)
+	require.Equal(t, idB, channels[1].ID)
+	require.False(t, channels[1].IsReady)
+	// The input is not reordered
+	require.Equal(t, uint64(11), txns[0].BlockNumber)
+}
+
+func TestGroupChannelsOrder(t *testing.T) {
+	idA, idB, idC := derive.ChannelID{0x03}, derive.ChannelID{0x02}, derive.ChannelID{0x01}
+	txns := []fetch.TransactionWithMetadata{
+		testTransaction(2, 12, 0, derive.Frame{ID: idC}),
+		testTransaction(1, 11, 0, derive.Frame{ID: idA}),
+		testTransaction(0, 11, 1, derive.Frame{ID: idB}),
+	}
+	channels, _ := groupChannels(Config{}, &rollup.Config{}, txns)
+	require.Len(t, channels, 3)
+	// Ordered by first inclusion block, ties broken by channel ID
+	require.Equal(t, idB, channels[0].id)
+	require.Equal(t, idA, channels[1].id)
+	require.Equal(t, idC, channels[2].id)
+}
+
+func TestGroupChannelsSortBy(t *testing.T) {
+	idA, idB, idC := derive.ChannelID{0x03}, derive.ChannelID{0x02}, derive.ChannelID{0x01}
+	newTxns := func() []fetch.TransactionWithMetadata {
+		return []fetch.TransactionWithMetadata{
+			testTransaction(0, 10, 0, derive.Frame{ID: idA, Data: make([]byte, 1)}),
+			testTransaction(1, 11, 0, derive.Frame{ID: idB, Data: make([]byte, 5)}),
+			testTransaction(2, 12, 0, derive.Frame{ID: idC, Data: make([]byte, 1)}, derive.Frame{ID: idC, FrameNumber: 1}),
+		}
+	}
+	ids := func(channels []channelFrames, _ []InvalidChannelIDFrame) []derive.ChannelID {
+		var out []derive.ChannelID
+		for _, ch := range channels {
+			out = append(out, ch.id)
+		}
+		return out
+	}
+	require.Equal(t, []derive.ChannelID{idA, idB, idC}, ids(groupChannels(Config{SortBy: SortByBlock}, &rollup.Config{}, newTxns())))
+	require.Equal(t, []derive.ChannelID{idC, idA, idB}, ids(groupChannels(Config{SortBy: SortByFrameCount}, &rollup.Config{}, newTxns())))
+	require.Equal(t, []derive.ChannelID{idB, idA, idC}, ids(groupChannels(Config{SortBy: SortByDataSize}, &rollup.Config{}, newTxns())))
+
+	_, err := Channels(context.Background(), Config{OutDirectory: t.TempDir(), SortBy: "unknown"}, &rollup.Config{})
+	require.ErrorContains(t, err, "unknown sort order")
+}
+
+func TestProcessFramesInclusionGap(t *testing.T) {
+	id := derive.ChannelID{0x0e}
+	frames := []FrameWithMetadata{
+		{InclusionBlock: 10, Frame: derive.Frame{ID: id, FrameNumber: 0}},
+		{InclusionBlock: 10, Frame: derive.Frame{ID: id, FrameNumber: 1}},
+		{InclusionBlock: 510, Frame: derive.Frame{ID: id, FrameNumber: 2}},
+		{InclusionBlock: 512, Frame: derive.Frame{ID: id, FrameNumber: 3, IsLast: true}},
+	}
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.Equal(t, uint64(10), ch.FirstInclusionBlock)
+	require.Equal(t, uint64(512), ch.LastInclusionBlock)
+	require.Equal(t, uint64(502), ch.BlockSpan)
+	require.Equal(t, uint64(500), ch.MaxInclusionGap)
+	require.Equal(t, 3, ch.InclusionBlocks)
+}
+
+func TestProcessFramesPreBedrock(t *testing.T) {
+	id := derive.ChannelID{0x22}
+	frames := []FrameWithMetadata{
+		{InclusionBlock: 9, Frame: derive.Frame{ID: id, FrameNumber: 0, Data: []byte{0x01}}},
+		{InclusionBlock: 10, Frame: derive.Frame{ID: id, FrameNumber: 1, Data: []byte{0x02}, IsLast: true}},
+	}
+	rollupCfg := &rollup.Config{Genesis: rollup.Genesis{L1: eth.BlockID{Number: 10}}}
+	// Pre-Bedrock frames are only flagged if legacy batches are decoded
+	ch := ProcessFrames(Config{}, rollupCfg, id, frames)
+	require.False(t, ch.InvalidFrames)
+	require.True(t, ch.IsReady)
+	require.Empty(t, ch.SkippedFrames)
+
+	ch = ProcessFrames(Config{LegacyBatches: true}, rollupCfg, id, frames)
+	require.True(t, ch.InvalidFrames)
+	require.False(t, ch.IsReady)
+	require.Equal(t, []SkippedFrame{{frames[0], SkipReasonPreBedrock}}, ch.SkippedFrames)
+}
+
+// encodeLegacyBatch encodes the calldata of an appendSequencerBatch call.
+func encodeLegacyBatch(t *testing.T, compressed bool, contexts []LegacyBatchContext, txs ...[]byte) []byte {
+	appendUint := func(b []byte, v uint64, size int) []byte {
+		return append(b, binary.BigEndian.AppendUint64(nil, v)[8-size:]...)
+	}
+	data := appendUint(appendUint(slices.Clone(appendSequencerBatchSelector), 100, 5), uint64(len(txs)), 3)
+	if compressed {
+		contexts = append([]LegacyBatchContext{{}}, contexts...)
+	}
+	data = appendUint(data, uint64(len(contexts)), 3)
+	for _, ctx := range contexts {
+		data = appendUint(appendUint(data, ctx.NumSequencedTxs, 3), ctx.NumSubsequentQueueTxs, 3)
+		data = appendUint(appendUint(data, ctx.Timestamp, 5), ctx.BlockNumber, 5)
+	}
+	var body []byte
+	for _, tx := range txs {
+		body = append(appendUint(body, uint64(len(tx)), 3), tx...)
+	}
+	if compressed {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		_, err := zw.Write(body)
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		body = buf.Bytes()
+	}
+	return append(data, body...)
+}
+
+func TestDecodeLegacyBatch(t *testing.T) {
+	contexts := []LegacyBatchContext{
+		{NumSequencedTxs: 1, NumSubsequentQueueTxs: 2, Timestamp: 1000, BlockNumber: 50},
+		{NumSequencedTxs: 1, Timestamp: 1010, BlockNumber: 51},
+	}
+	txs := [][]byte{{0xc0}, {0xc1, 0x80}}
+	for _, compressed := range []bool{false, true} {
+		batch, err := decodeLegacyBatch(encodeLegacyBatch(t, compressed, contexts, txs...))
+		require.NoError(t, err)
+		require.Equal(t, compressed, batch.Compressed)
+		require.Equal(t, uint64(100), batch.ShouldStartAtElement)
+		require.Equal(t, uint64(2), batch.TotalElementsToAppend)
+		require.Equal(t, contexts, batch.Contexts)
+		require.Equal(t, []hexutil.Bytes{{0xc0}, {0xc1, 0x80}}, batch.Transactions)
+	}
+
+	_, err := decodeLegacyBatch([]byte{0x00, 0x01})
+	require.ErrorContains(t, err, "not an appendSequencerBatch call")
+	_, err = decodeLegacyBatch(encodeLegacyBatch(t, false, contexts, txs[0]))
+	require.ErrorContains(t, err, "contexts sequence 2 transactions")
+	data := encodeLegacyBatch(t, false, contexts, txs...)
+	_, err = decodeLegacyBatch(data[:len(data)-1])
+	require.ErrorContains(t, err, "truncated transaction 1")
+}
+
+func TestChannelsLegacyBatches(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	legacy := testTransaction(0, 5, 0)
+	legacy.Tx = types.NewTx(&types.LegacyTx{To: &testInbox,
+		Data: encodeLegacyBatch(t, true, []LegacyBatchContext{{NumSequencedTxs: 1, Timestamp: 1000}}, []byte{0xc0})})
+	writeTransaction(t, in, legacy)
+	invalid := testTransaction(1, 6, 0, derive.Frame{ID: derive.ChannelID{0x3a}, IsLast: true})
+	writeTransaction(t, in, invalid)
+	writeTransaction(t, in, testTransaction(2, 10, 0, derive.Frame{ID: derive.ChannelID{0x3b}, IsLast: true}))
+
+	rollupCfg := &rollup.Config{Genesis: rollup.Genesis{L1: eth.BlockID{Number: 10}}}
+	result, err := Channels(context.Background(), Config{InDirectory: in, OutDirectory: out, LegacyBatches: true}, rollupCfg)
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Channels)
+	require.Equal(t, 1, result.SkippedFrames)
+
+	data, err := os.ReadFile(path.Join(out, LegacyBatchesFilename))
+	require.NoError(t, err)
+	var batches []LegacyBatch
+	require.NoError(t, json.Unmarshal(data, &batches))
+	require.Len(t, batches, 2)
+	require.Equal(t, legacy.Tx.Hash(), batches[0].TxHash)
+	require.True(t, batches[0].Compressed)
+	require.Equal(t, []hexutil.Bytes{{0xc0}}, batches[0].Transactions)
+	require.Empty(t, batches[0].Error)
+	require.Equal(t, invalid.Tx.Hash(), batches[1].TxHash)
+	require.NotEmpty(t, batches[1].Error)
+}
+
+func TestGroupChannelsFilter(t *testing.T) {
+	idA, idB := derive.ChannelID{0x0a}, derive.ChannelID{0x0b}
+	txns := []fetch.TransactionWithMetadata{
+		testTransaction(0, 10, 0, derive.Frame{ID: idA}, derive.Frame{ID: idB}),
+		testTransaction(1, 11, 0, derive.Frame{ID: idB, FrameNumber: 1}),
+	}
+	channels, _ := groupChannels(Config{ChannelIDs: []derive.ChannelID{idB}}, &rollup.Config{}, txns)
+	require.Len(t, channels, 1)
+	require.Equal(t, idB, channels[0].id)
+	require.Len(t, channels[0].frames, 2)
+	// The transactions are released once their frames are grouped
+	require.Equal(t, fetch.TransactionWithMetadata{}, txns[0])
+	require.Equal(t, fetch.TransactionWithMetadata{}, txns[1])
+}
+
+func TestGroupChannelsZeroChannelID(t *testing.T) {
+	id := derive.ChannelID{0x0c}
+	txns := []fetch.TransactionWithMetadata{
+		testTransaction(0, 10, 0, derive.Frame{ID: id}, derive.Frame{FrameNumber: 3}),
+	}
+	txHash := txns[0].Tx.Hash()
+	channels, invalid := groupChannels(Config{}, &rollup.Config{}, txns)
+	require.Len(t, channels, 1)
+	require.Equal(t, id, channels[0].id)
+	require.Equal(t, []InvalidChannelIDFrame{{TxHash: txHash, InclusionBlock: 10, FrameNumber: 3}}, invalid)
+}
+
+func TestProcessFramesKeepsEarliestDuplicate(t *testing.T) {
+	id := derive.ChannelID{0x0f}
+	late := FrameWithMetadata{InclusionBlock: 20, TxHash: common.Hash{0x02},
+		Frame: derive.Frame{ID: id, FrameNumber: 0, Data: []byte{0xbb}}}
+	sameBlockLater := FrameWithMetadata{InclusionBlock: 10, TxIndex: 3, TxHash: common.Hash{0x03},
+		Frame: derive.Frame{ID: id, FrameNumber: 0, Data: []byte{0xcc}}}
+	early := FrameWithMetadata{InclusionBlock: 10, TxIndex: 1, TxHash: common.Hash{0x01},
+		Frame: derive.Frame{ID: id, FrameNumber: 0, Data: []byte{0xaa}}}
+	closing := FrameWithMetadata{InclusionBlock: 21, TxHash: common.Hash{0x04},
+		Frame: derive.Frame{ID: id, FrameNumber: 1, Data: []byte{0xdd}, IsLast: true}}
+
+	// Deliberately pass the duplicates in reverse inclusion order
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, []FrameWithMetadata{late, closing, sameBlockLater, early})
+	require.Equal(t, uint64(10), ch.OpenBlock)
+	require.Equal(t, []FrameWithMetadata{early, sameBlockLater, late, closing}, ch.Frames)
+	// The duplicates carry different data, so they conflict with the kept frame
+	require.Equal(t, []SkippedFrame{{sameBlockLater, SkipReasonConflicting}, {late, SkipReasonConflicting}}, ch.SkippedFrames)
+	require.Equal(t, uint64(2), ch.AssembledSize)
+	require.True(t, ch.InvalidFrames)
+}
+
+func TestProcessFramesConflictingFrames(t *testing.T) {
+	id := derive.ChannelID{0x15}
+	frames := []FrameWithMetadata{
+		{InclusionBlock: 10, TxHash: common.Hash{0x01}, Frame: derive.Frame{ID: id, FrameNumber: 0, Data: []byte{0xaa}}},
+		{InclusionBlock: 11, TxHash: common.Hash{0x02}, Frame: derive.Frame{ID: id, FrameNumber: 0, Data: []byte{0xaa}}},
+		{InclusionBlock: 12, TxHash: common.Hash{0x03}, Frame: derive.Frame{ID: id, FrameNumber: 0, Data: []byte{0xbb}}},
+		{InclusionBlock: 13, TxHash: common.Hash{0x04}, Frame: derive.Frame{ID: id, FrameNumber: 0, Data: []byte{0xaa}, IsLast: true}},
+	}
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.Equal(t, []SkippedFrame{
+		{frames[1], SkipReasonDuplicate},
+		{frames[2], SkipReasonConflicting},
+		{frames[3], SkipReasonConflicting},
+	}, ch.SkippedFrames)
+	require.Equal(t, []ConflictingFrame{
+		{FrameNumber: 0, KeptTxHash: common.Hash{0x01}, ConflictingTxHash: common.Hash{0x03}},
+		{FrameNumber: 0, KeptTxHash: common.Hash{0x01}, ConflictingTxHash: common.Hash{0x04}},
+	}, ch.ConflictingFrames)
+}
+
+func TestProcessFramesSkipReasons(t *testing.T) {
+	id := derive.ChannelID{0x10}
+	frames := testFrames(10,
+		derive.Frame{ID: id, FrameNumber: 2, IsLast: true},
+		derive.Frame{ID: id, FrameNumber: 3},
+		derive.Frame{ID: id, FrameNumber: 0},
+		derive.Frame{ID: id, FrameNumber: 1},
+		derive.Frame{ID: id, FrameNumber: 1})
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.True(t, ch.IsReady)
+	require.Equal(t, []SkippedFrame{
+		{frames[1], SkipReasonPastChannelEnd},
+		{frames[4], SkipReasonChannelReady},
+	}, ch.SkippedFrames)
+}
+
+func TestChannelsErrorManifest(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	ready, open := derive.ChannelID{0x11, 0x01}, derive.ChannelID{0x11, 0x02}
+	writeTransaction(t, in, testTransaction(0, 10, 0, derive.Frame{ID: ready, IsLast: true}))
+	writeTransaction(t, in, testTransaction(1, 11, 0, derive.Frame{ID: open, FrameNumber: 3}))
+	writeTransaction(t, in, testTransaction(2, 12, 0, derive.Frame{ID: open, FrameNumber: 1}))
+
+	require.NoError(t, runChannels(context.Background(), Config{InDirectory: in, OutDirectory: out}, &rollup.Config{}))
+	data, err := os.ReadFile(path.Join(out, ErrorsFilename))
+	require.NoError(t, err)
+	var manifest ErrorManifest
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	require.Equal(t, []ChannelErrorEntry{{
+		ID:                  open,
+		MissingFrameNumbers: []uint16{0, 2},
+		FirstInclusionBlock: 11,
+	}}, manifest.Channels)
+}
+
+func TestChannelsSplitsReusedChannelIDs(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	id := derive.ChannelID{0x11, 0x07}
+	writeTransaction(t, in, testTransaction(0, 10, 0, derive.Frame{ID: id}))
+	writeTransaction(t, in, testTransaction(1, 60, 0, derive.Frame{ID: id, FrameNumber: 1, IsLast: true}))
+	// Included more than the channel timeout after the previous frame
+	writeTransaction(t, in, testTransaction(2, 111, 0, derive.Frame{ID: id, IsLast: true}))
+
+	require.NoError(t, runChannels(context.Background(), Config{InDirectory: in, OutDirectory: out, ChannelTimeout: 50}, &rollup.Config{}))
+	for i, name := range []string{id.String(), id.String() + "-1"} {
+		data, err := os.ReadFile(path.Join(out, name+".json"))
+		require.NoError(t, err)
+		var ch struct {
+			IsReady      bool `json:"is_ready"`
+			IDReused     bool `json:"id_reused"`
+			IDReuseIndex int  `json:"id_reuse_index"`
+		}
+		require.NoError(t, json.Unmarshal(data, &ch))
+		require.True(t, ch.IsReady)
+		require.True(t, ch.IDReused)
+		require.Equal(t, i, ch.IDReuseIndex)
+	}
+
+	newTxns := func() []fetch.TransactionWithMetadata {
+		return []fetch.TransactionWithMetadata{
+			testTransaction(0, 10, 0, derive.Frame{ID: id}),
+			testTransaction(1, 1000, 0, derive.Frame{ID: id, IsLast: true}),
+		}
+	}
+	// Without a channel timeout the default config falls back to the chain spec
+	channels, _ := groupChannels(Config{}, &rollup.Config{ChannelTimeoutBedrock: 50}, newTxns())
+	require.Len(t, channels, 2)
+	require.True(t, channels[1].reused)
+	require.Equal(t, 1, channels[1].reuseIndex)
+
+	// Without any channel timeout the frames form a single channel
+	channels, _ = groupChannels(Config{}, &rollup.Config{}, newTxns())
+	require.Len(t, channels, 1)
+	require.False(t, channels[0].reused)
+}
+
+func TestErrorManifestReusedChannelIDs(t *testing.T) {
+	id := derive.ChannelID{0x11, 0x0b}
+	var manifest ErrorManifest
+	for _, i := range []int{1, 0} {
+		manifest.add(ChannelWithMetadata{ID: id, IDReused: true, IDReuseIndex: i})
+	}
+	manifest.sort()
+	require.Len(t, manifest.Channels, 2)
+	for i, entry := range manifest.Channels {
+		require.Equal(t, id, entry.ID)
+		require.Equal(t, i, entry.IDReuseIndex)
+	}
+}
+
+func TestChannelsDumpPayloads(t *testing.T) {
+	in, out, payloads := t.TempDir(), t.TempDir(), t.TempDir()
+	ready, open, corrupt := derive.ChannelID{0x11, 0x08}, derive.ChannelID{0x11, 0x09}, derive.ChannelID{0x11, 0x0a}
+	batch := &derive.SingularBatch{Timestamp: 1}
+	for i, frame := range testChannelFrames(t, ready, 1000, batch) {
+		writeTransaction(t, in, testTransaction(uint64(i), 10, uint64(i), frame))
+	}
+	writeTransaction(t, in, testTransaction(5, 11, 0, derive.Frame{ID: open}))
+	writeTransaction(t, in, testTransaction(6, 12, 0, derive.Frame{ID: corrupt, Data: []byte{0xff}, IsLast: true}))
+
+	config := Config{InDirectory: in, OutDirectory: out, DumpPayloads: payloads}
+	require.NoError(t, runChannels(context.Background(), config, &rollup.Config{}))
+	data, err := os.ReadFile(path.Join(payloads, ready.String()+PayloadSuffix))
+	require.NoError(t, err)
+	var expected bytes.Buffer
+	require.NoError(t, rlp.Encode(&expected, derive.NewBatchData(batch)))
+	require.Equal(t, expected.Bytes(), data)
+
+	entries, err := os.ReadDir(payloads)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestChannelsReadyOnly(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	ready, open := derive.ChannelID{0x11, 0x05}, derive.ChannelID{0x11, 0x06}
+	writeTransaction(t, in, testTransaction(0, 10, 0, derive.Frame{ID: ready, IsLast: true}))
+	writeTransaction(t, in, testTransaction(1, 11, 0, derive.Frame{ID: open}))
+
+	require.NoError(t, runChannels(context.Background(), Config{InDirectory: in, OutDirectory: out, ReadyOnly: true}, &rollup.Config{}))
+	_, err := os.Stat(path.Join(out, ready.String()+".json"))
+	require.NoError(t, err)
+	_, err = os.Stat(path.Join(out, open.String()+".json"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	data, err := os.ReadFile(path.Join(out, IndexFilename))
+	require.NoError(t, err)
+	var index Index
+	require.NoError(t, json.Unmarshal(data, &index))
+	require.Len(t, index.Channels, 1)
+	require.Equal(t, ready, index.Channels[0].ID)
+	require.Equal(t, 2, index.Stats.Channels)
+
+	data, err = os.ReadFile(path.Join(out, ErrorsFilename))
+	require.NoError(t, err)
+	var manifest ErrorManifest
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	require.Len(t, manifest.Channels, 1)
+	require.Equal(t, open, manifest.Channels[0].ID)
+}
+
+func TestChannelsPostProcessors(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	idA, idB := derive.ChannelID{0x11, 0x03}, derive.ChannelID{0x11, 0x04}
+	writeTransaction(t, in, testTransaction(0, 10, 0, derive.Frame{ID: idA, IsLast: true}))
+	writeTransaction(t, in, testTransaction(1, 11, 0, derive.Frame{ID: idB, IsLast: true}))
+
+	config := Config{InDirectory: in, OutDirectory: out, PostProcessors: []PostProcessor{
+		func(ch *ChannelWithMetadata) error {
+			ch.DecodeError = "enriched"
+			return nil
+		},
+		func(ch *ChannelWithMetadata) error {
+			if ch.ID == idB {
+				return errors.New("rejected")
+			}
+			return nil
+		},
+	}}
+	require.NoError(t, runChannels(context.Background(), config, &rollup.Config{}))
+	for _, id := range []derive.ChannelID{idA, idB} {
+		data, err := os.ReadFile(path.Join(out, id.String()+".json"))
+		require.NoError(t, err)
+		var ch struct {
+			DecodeError string `json:"decode_error"`
+		}
+		require.NoError(t, json.Unmarshal(data, &ch))
+		require.Equal(t, "enriched", ch.DecodeError)
+	}
+
+	data, err := os.ReadFile(path.Join(out, ErrorsFilename))
+	require.NoError(t, err)
+	var manifest ErrorManifest
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	require.Equal(t, []ChannelErrorEntry{{
+		ID:                  idB,
+		IsReady:             true,
+		Closed:              true,
+		FirstInclusionBlock: 11,
+		PostProcessErrors:   []string{"rejected"},
+	}}, manifest.Channels)
+}
+
+func TestLoadTransactionsBatchInboxes(t *testing.T) {
+	dir := t.TempDir()
+	inboxes := []common.Address{{0x01}, {0x02}, {0x03}}
+	for i, inbox := range inboxes {
+		txm := testTransaction(uint64(i), 10+uint64(i), 0, derive.Frame{ID: derive.ChannelID{0x12}, FrameNumber: uint16(i)})
+		txm.InboxAddr = inbox
+		writeTransaction(t, dir, txm)
+	}
+	txns, err := loadTransactions(context.Background(), Config{InDirectory: dir, BatchInboxes: inboxes[:2]})
+	require.NoError(t, err)
+	require.Len(t, txns, 2)
+	for _, txm := range txns {
+		require.Contains(t, inboxes[:2], txm.InboxAddr)
+	}
+
+	txns, err = loadTransactions(context.Background(), Config{InDirectory: dir, BatchInboxes: []common.Address{{}}})
+	require.NoError(t, err)
+	require.Len(t, txns, 3)
+
+	sortTransactions(txns)
+	frames := transactionsToFrames(txns, Config{})
+	require.Equal(t, inboxes[2], frames[2].InboxAddr)
+}
+
+func TestProcessFramesL1GasUsed(t *testing.T) {
+	id := derive.ChannelID{0x13}
+	withData := func(txm fetch.TransactionWithMetadata, data []byte) fetch.TransactionWithMetadata {
+		txm.Tx = types.NewTx(&types.DynamicFeeTx{Nonce: txm.Tx.Nonce(), To: &testInbox, Data: data})
+		return txm
+	}
+	txns := []fetch.TransactionWithMetadata{
+		// Both frames of the first transaction belong to the channel, its gas is only counted once
+		withData(testTransaction(0, 10, 0, derive.Frame{ID: id, FrameNumber: 0}, derive.Frame{ID: id, FrameNumber: 1}), []byte{0x00, 0x01, 0x02}),
+		withData(testTransaction(1, 11, 0, derive.Frame{ID: id, FrameNumber: 2, IsLast: true}), []byte{0x00, 0x00}),
+	}
+	frames := transactionsToFrames(txns, Config{})
+	require.Equal(t, uint64(4+16+16), frames[0].CalldataGas)
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.Equal(t, uint64(4+16+16+4+4), ch.L1GasUsed)
+
+	frames = transactionsToFrames(txns, Config{GasModel: GasModelEIP7623})
+	require.Equal(t, uint64((1+4+4)*10), frames[0].CalldataGas)
+	// Without a gas model, the model is selected by the block time of the transaction
+	pragueCfg := Config{L1PragueTime: txns[1].BlockTime}.withL1PragueTime(&rollup.Config{L1ChainID: big.NewInt(1)})
+	ch = ProcessFrames(pragueCfg, &rollup.Config{}, id, transactionsToFrames(txns, pragueCfg))
+	require.Equal(t, uint64(4+16+16+(1+1)*10), ch.L1GasUsed)
+}
+
+func TestL1PragueTime(t *testing.T) {
+	require.Equal(t, uint64(1746612311), L1PragueTime(big.NewInt(1)))
+	require.Zero(t, L1PragueTime(big.NewInt(10)))
+	require.Zero(t, L1PragueTime(nil))
+	cfg := Config{}.withL1PragueTime(&rollup.Config{L1ChainID: big.NewInt(1)})
+	require.Equal(t, GasModelEIP2028, cfg.gasModel(1746612310))
+	require.Equal(t, GasModelEIP7623, cfg.gasModel(1746612311))
+	require.Equal(t, GasModelEIP2028, Config{}.withL1PragueTime(nil).gasModel(1746612311))
+
+	model, err := ParseGasModel("eip7623")
+	require.NoError(t, err)
+	require.Equal(t, GasModelEIP7623, model)
+	_, err = ParseGasModel("london")
+	require.Error(t, err)
+}
+
+func TestChannelsProgress(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	for i := byte(0); i < 3; i++ {
+		writeTransaction(t, in, testTransaction(uint64(i), 10, uint64(i), derive.Frame{ID: derive.ChannelID{0x14, i}}))
+	}
+	writeTransaction(t, in, testTransaction(3, 11, 0, derive.Frame{ID: derive.ChannelID{0x14, 0x00}, FrameNumber: 1}))
+	var calls [][2]int
+	config := Config{InDirectory: in, OutDirectory: out, ProgressFunc: func(done, total int) {
+		calls = append(calls, [2]int{done, total})
+	}}
+	require.NoError(t, runChannels(context.Background(), config, &rollup.Config{}))
+	require.Equal(t, [][2]int{{1, 4}, {2, 4}, {3, 4}, {4, 4}, {1, 3}, {2, 3}, {3, 3}}, calls)
+}
+
+func TestReadPayloadBatchTypes(t *testing.T) {
+	var payload []byte
+	for _, data := range [][]byte{{derive.SpanBatchType, 0x01}, {derive.SingularBatchType}, {derive.SpanBatchType}} {
+		enc, err := rlp.EncodeToBytes(data)
+		require.NoError(t, err)
+		payload = append(payload, enc...)
+	}
+	types, err := readPayloadBatchTypes(payload)
+	require.NoError(t, err)
+	require.Equal(t, []int{derive.SingularBatchType, derive.SpanBatchType}, types)
+
+	types, err = readPayloadBatchTypes(append(payload, 0x85, 0x01))
+	require.Error(t, err)
+	require.Equal(t, []int{derive.SingularBatchType, derive.SpanBatchType}, types)
+}
+
+func TestChannelsPermissions(t *testing.T) {
+	in, out := t.TempDir(), path.Join(t.TempDir(), "channels")
+	id := derive.ChannelID{0x15}
+	writeTransaction(t, in, testTransaction(0, 10, 0, derive.Frame{ID: id, IsLast: true}))
+	config := Config{InDirectory: in, OutDirectory: out, DirPerm: 0700, FilePerm: 0600}
+	require.NoError(t, runChannels(context.Background(), config, &rollup.Config{}))
+
+	info, err := os.Stat(out)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	for _, name := range []string{id.String() + ".json", IndexFilename, ErrorsFilename} {
+		info, err := os.Stat(path.Join(out, name))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0600), info.Mode().Perm(), name)
+	}
+}
+
+func TestChannelsSingleFile(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	var ids []derive.ChannelID
+	for i := byte(0); i < 4; i++ {
+		id := derive.ChannelID{0x16, i}
+		ids = append(ids, id)
+		writeTransaction(t, in, testTransaction(uint64(i), 10+uint64(i), 0, derive.Frame{ID: id, IsLast: true}))
+	}
+	file := path.Join(out, "channels.json")
+	config := Config{InDirectory: in, OutDirectory: path.Join(out, "unused"), SingleFile: file, Concurrency: 2}
+	require.NoError(t, runChannels(context.Background(), config, &rollup.Config{}))
+	require.NoDirExists(t, config.OutDirectory)
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	var channels []struct {
+		ID derive.ChannelID `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(data, &channels))
+	var got []derive.ChannelID
+	for _, ch := range channels {
+		got = append(got, ch.ID)
+	}
+	require.ElementsMatch(t, ids, got)
+
+	// An empty input results in an empty array
+	require.NoError(t, runChannels(context.Background(), Config{InDirectory: t.TempDir(), SingleFile: file}, &rollup.Config{}))
+	data, err = os.ReadFile(file)
+	require.NoError(t, err)
+	require.JSONEq(t, "[]", string(data))
+
+	config.OutputFormat = OutputFormatCSV
+	require.Error(t, runChannels(context.Background(), config, &rollup.Config{}))
+}
+
+func TestProcessFramesVerifyRoundTrip(t *testing.T) {
+	id := derive.ChannelID{0x17}
+	batch := &derive.SingularBatch{ParentHash: common.Hash{0x01}, EpochNum: 3, Timestamp: 100}
+	frames := testFrames(10, testChannelFrames(t, id, 16, batch)...)
+
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.Nil(t, ch.RoundTripMatch)
+
+	ch = ProcessFrames(Config{VerifyRoundTrip: true}, &rollup.Config{}, id, frames)
+	require.NotNil(t, ch.RoundTripMatch)
+	require.True(t, *ch.RoundTripMatch)
+	require.Empty(t, ch.RoundTripDiff)
+
+	match, diff := verifyRoundTrip(ch.Batches, []byte{0x01})
+	require.False(t, match)
+	require.Contains(t, diff, "first difference at offset 0")
+}
+
+func TestProcessFramesCompressionType(t *testing.T) {
+	id := derive.ChannelID{0x18}
+	frames := testFrames(10, testChannelFrames(t, id, 16, &derive.SingularBatch{Timestamp: 1})...)
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.Equal(t, "zlib", ch.CompressionType)
+
+	ch = ProcessFrames(Config{}, &rollup.Config{}, id, frames[:1])
+	require.Equal(t, CompressionTypeUnknown, ch.CompressionType)
+
+	brotliFrames := testFrames(10, derive.Frame{ID: id, Data: []byte{derive.ChannelVersionBrotli, 0x00}, IsLast: true})
+	ch = ProcessFrames(Config{}, &rollup.Config{}, id, brotliFrames)
+	require.Equal(t, "brotli", ch.CompressionType)
+
+	unknownFrames := testFrames(10, derive.Frame{ID: id, Data: []byte{0x02}, IsLast: true})
+	ch = ProcessFrames(Config{}, &rollup.Config{}, id, unknownFrames)
+	require.Equal(t, CompressionTypeUnknown, ch.CompressionType)
+}
+
+func TestLoadTransactionsTimeWindow(t *testing.T) {
+	dir := t.TempDir()
+	// testTransaction uses a block time of block * 12
+	for i := uint64(0); i < 5; i++ {
+		writeTransaction(t, dir, testTransaction(i, 10+i, 0))
+	}
+	noTime := testTransaction(5, 20, 0)
+	noTime.BlockTime = 0
+	writeTransaction(t, dir, noTime)
+
+	config := Config{InDirectory: dir, SinceTime: time.Unix(11*12, 0), UntilTime: time.Unix(13*12, 0)}
+	txns, err := loadTransactions(context.Background(), config)
+	require.NoError(t, err)
+	var blocks []uint64
+	for _, txm := range txns {
+		blocks = append(blocks, txm.BlockNumber)
+	}
+	require.ElementsMatch(t, []uint64{11, 12, 13, 20}, blocks)
+}
+
+func TestChannelsResume(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	done, corrupt, missing := derive.ChannelID{0x19, 0x01}, derive.ChannelID{0x19, 0x02}, derive.ChannelID{0x19, 0x03}
+	for i, id := range []derive.ChannelID{done, corrupt, missing} {
+		writeTransaction(t, in, testTransaction(uint64(i), 10+uint64(i), 0, derive.Frame{ID: id, IsLast: true}))
+	}
+	doneFile := path.Join(out, done.String()+".json")
+	corruptFile := path.Join(out, corrupt.String()+".json")
+	doneData := []byte(`{"id":"` + done.String() + `","marker":true}`)
+	require.NoError(t, os.WriteFile(doneFile, doneData, 0644))
+	require.NoError(t, os.WriteFile(corruptFile, []byte(`{"id":"`+corrupt.String()+`","fra`), 0644))
+
+	require.NoError(t, runChannels(context.Background(), Config{InDirectory: in, OutDirectory: out, Resume: true}, &rollup.Config{}))
+	data, err := os.ReadFile(doneFile)
+	require.NoError(t, err)
+	require.Equal(t, doneData, data)
+	for _, id := range []derive.ChannelID{corrupt, missing} {
+		require.True(t, isChannelFile(path.Join(out, id.String()+".json"), id))
+	}
+
+	data, err = os.ReadFile(path.Join(out, IndexFilename))
+	require.NoError(t, err)
+	var index Index
+	require.NoError(t, json.Unmarshal(data, &index))
+	require.Len(t, index.Channels, 3)
+}
+
+func TestTransactionsToFramesRawCalldata(t *testing.T) {
+	txm := testTransaction(0, 10, 0, derive.Frame{ID: derive.ChannelID{0x1a}})
+	txm.Tx = types.NewTx(&types.DynamicFeeTx{To: &testInbox, Data: []byte{0x00, 0xab}})
+	txns := []fetch.TransactionWithMetadata{txm}
+	require.Nil(t, transactionsToFrames(txns, Config{})[0].Calldata)
+	require.Equal(t, hexutil.Bytes{0x00, 0xab}, transactionsToFrames(txns, Config{IncludeRawCalldata: true})[0].Calldata)
+}
+
+func TestChannelsRejectedSenders(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	id := derive.ChannelID{0x1b}
+	writeTransaction(t, in, testTransaction(0, 10, 0, derive.Frame{ID: id, IsLast: true}))
+	spoofed := testTransaction(1, 11, 0, derive.Frame{ID: derive.ChannelID{0x1c}, IsLast: true})
+	spoofed.ValidSender = false
+	spoofed.Sender = common.Address{0xee}
+	writeTransaction(t, in, spoofed)
+
+	require.NoError(t, runChannels(context.Background(), Config{InDirectory: in, OutDirectory: out}, &rollup.Config{}))
+	require.NoFileExists(t, path.Join(out, derive.ChannelID{0x1c}.String()+".json"))
+	data, err := os.ReadFile(path.Join(out, RejectedSendersFilename))
+	require.NoError(t, err)
+	var rejected []RejectedTransaction
+	require.NoError(t, json.Unmarshal(data, &rejected))
+	require.Equal(t, []RejectedTransaction{{
+		TxHash:      spoofed.Tx.Hash(),
+		BlockNumber: 11,
+		Sender:      common.Address{0xee},
+		InboxAddr:   testInbox,
+	}}, rejected)
+
+	// Without rejected transactions, an empty list is written
+	in, out = t.TempDir(), t.TempDir()
+	writeTransaction(t, in, testTransaction(0, 10, 0, derive.Frame{ID: id, IsLast: true}))
+	require.NoError(t, runChannels(context.Background(), Config{InDirectory: in, OutDirectory: out}, &rollup.Config{}))
+	data, err = os.ReadFile(path.Join(out, RejectedSendersFilename))
+	require.NoError(t, err)
+	require.JSONEq(t, "[]", string(data))
+}
+
+func TestChannelsVerifyChecksums(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	good := testTransaction(0, 10, 0, derive.Frame{ID: derive.ChannelID{0x1d}, IsLast: true})
+	corrupt := testTransaction(1, 11, 0, derive.Frame{ID: derive.ChannelID{0x1e}, IsLast: true})
+	unchecked := testTransaction(2, 12, 0, derive.Frame{ID: derive.ChannelID{0x1f}, IsLast: true})
+	for _, txm := range []fetch.TransactionWithMetadata{good, corrupt, unchecked} {
+		writeTransaction(t, in, txm)
+	}
+	writeChecksum := func(txm fetch.TransactionWithMetadata, sum [32]byte) {
+		file := path.Join(in, txm.Tx.Hash().String()+".json")
+		line := hex.EncodeToString(sum[:]) + "  " + path.Base(file) + "\n"
+		require.NoError(t, os.WriteFile(file+ChecksumSuffix, []byte(line), 0644))
+	}
+	data, err := os.ReadFile(path.Join(in, good.Tx.Hash().String()+".json"))
+	require.NoError(t, err)
+	writeChecksum(good, sha256.Sum256(data))
+	writeChecksum(corrupt, sha256.Sum256([]byte("other")))
+
+	_, err = Channels(context.Background(), Config{InDirectory: in, OutDirectory: out, VerifyChecksums: true}, &rollup.Config{})
+	var checksumErr *ChecksumError
+	require.ErrorAs(t, err, &checksumErr)
+	require.FileExists(t, path.Join(out, derive.ChannelID{0x1d}.String()+".json"))
+	require.NoFileExists(t, path.Join(out, derive.ChannelID{0x1e}.String()+".json"))
+	require.FileExists(t, path.Join(out, derive.ChannelID{0x1f}.String()+".json"))
+
+	data, err = os.ReadFile(path.Join(out, ChecksumErrorsFilename))
+	require.NoError(t, err)
+	var mismatches []ChecksumError
+	require.NoError(t, json.Unmarshal(data, &mismatches))
+	require.Len(t, mismatches, 1)
+	require.Equal(t, path.Join(in, corrupt.Tx.Hash().String()+".json"), mismatches[0].File)
+
+	// Without verification, the sidecar files are ignored & all files are decoded
+	require.NoError(t, runChannels(context.Background(), Config{InDirectory: in, OutDirectory: t.TempDir()}, &rollup.Config{}))
+}
+
+func TestReassembleChannelsMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	config := Config{Metrics: NewMetrics(registry)}
+	ready, open := derive.ChannelID{0x20}, derive.ChannelID{0x21}
+	txns := []fetch.TransactionWithMetadata{
+		testTransaction(0, 10, 0, derive.Frame{ID: ready, IsLast: true}),
+		testTransaction(1, 11, 0, derive.Frame{ID: open}, derive.Frame{ID: open}),
+	}
+	ReassembleChannels(txns, config, &rollup.Config{})
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	counters := make(map[string]float64)
+	for _, family := range families {
+		counters[family.GetName()] = family.GetMetric()[0].GetCounter().GetValue()
+	}
+	require.Equal(t, map[string]float64{
+		"batch_decoder_channels_processed": 2,
+		"batch_decoder_channels_ready":     1,
+		"batch_decoder_channels_invalid":   1, // the duplicate frame
+		"batch_decoder_frames_skipped":     1,
+		"batch_decoder_bytes_decompressed": 0,
+	}, counters)
+}
+
+func TestLoadTransactionsSource(t *testing.T) {
+	source := TransactionSlice{
+		testTransaction(0, 10, 0, derive.Frame{ID: derive.ChannelID{0x1d}}),
+		testTransaction(1, 11, 0, derive.Frame{ID: derive.ChannelID{0x1d}, FrameNumber: 1}),
+	}
+	txns, err := loadTransactions(context.Background(), Config{Source: source, StartBlock: 11})
+	require.NoError(t, err)
+	require.Len(t, txns, 1)
+	require.Equal(t, uint64(11), txns[0].BlockNumber)
+
+	_, err = loadTransactions(context.Background(), Config{Source: source, InDirectory: t.TempDir()})
+	require.ErrorContains(t, err, "mutually exclusive")
+}
+
+func BenchmarkReassembleSource(b *testing.B) {
+	var source TransactionSlice
+	for i := 0; i < 1000; i++ {
+		id := derive.ChannelID{0x1e, byte(i >> 8), byte(i)}
+		source = append(source,
+			testTransaction(uint64(2*i), uint64(10+i), 0, derive.Frame{ID: id, Data: make([]byte, 100)}),
+			testTransaction(uint64(2*i+1), uint64(11+i), 1, derive.Frame{ID: id, FrameNumber: 1, Data: make([]byte, 100), IsLast: true}))
+	}
+	config := Config{Source: source}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		txns, err := loadTransactions(context.Background(), config)
+		require.NoError(b, err)
+		ReassembleChannels(txns, config, &rollup.Config{})
+	}
+}
+
+func TestProcessFramesEmptyFrames(t *testing.T) {
+	id := derive.ChannelID{0x1f}
+	frames := testFrames(10,
+		derive.Frame{ID: id, FrameNumber: 0, Data: []byte{0x01}},
+		derive.Frame{ID: id, FrameNumber: 1},
+		derive.Frame{ID: id, FrameNumber: 2, Data: []byte{0x02}, IsLast: true})
+
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.Equal(t, []FrameWithMetadata{frames[1]}, ch.EmptyFrames)
+	require.True(t, ch.IsReady)
+	require.False(t, ch.InvalidFrames)
+
+	ch = ProcessFrames(Config{SkipEmptyFrames: true}, &rollup.Config{}, id, frames)
+	require.Equal(t, []FrameWithMetadata{frames[1]}, ch.EmptyFrames)
+	require.Equal(t, []SkippedFrame{{frames[1], SkipReasonEmpty}}, ch.SkippedFrames)
+	require.False(t, ch.IsReady)
+	require.Equal(t, []uint16{1}, ch.MissingFrameNumbers)
+	require.Equal(t, uint16(2), *ch.HighestFrameNumber)
+}
+
+func TestProcessFramesHighestFrameNumber(t *testing.T) {
+	id := derive.ChannelID{0x28}
+	frames := testFrames(10,
+		derive.Frame{ID: id, FrameNumber: 1, Data: []byte{0x01}},
+		derive.Frame{ID: id, FrameNumber: 4, Data: []byte{0x02}})
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.False(t, ch.IsReady)
+	require.False(t, ch.Closed)
+	require.Equal(t, uint16(4), *ch.HighestFrameNumber)
+	require.Equal(t, []uint16{0, 2, 3}, ch.MissingFrameNumbers)
+
+	maxFrameNumber := uint16(0)
+	ch = ProcessFrames(Config{MaxFrameNumber: &maxFrameNumber}, &rollup.Config{}, id, frames)
+	require.Nil(t, ch.HighestFrameNumber)
+	require.Nil(t, ch.MissingFrameNumbers)
+}
+
+func TestProcessFramesMaxFrameNumber(t *testing.T) {
+	id := derive.ChannelID{0x20}
+	batch := &derive.SingularBatch{ParentHash: common.Hash{0x02}, Timestamp: 100, Transactions: []hexutil.Bytes{make([]byte, 64)}}
+	channelFrames := testChannelFrames(t, id, 8, batch)
+	require.Greater(t, len(channelFrames), 3)
+	frames := testFrames(10, channelFrames...)
+
+	maxFrameNumber := uint16(2)
+	ch := ProcessFrames(Config{MaxFrameNumber: &maxFrameNumber}, &rollup.Config{}, id, frames)
+	require.True(t, ch.Truncated)
+	require.False(t, ch.IsReady)
+	require.False(t, ch.InvalidFrames)
+	require.Len(t, ch.Frames, len(frames))
+	require.Len(t, ch.SkippedFrames, len(frames)-3)
+	for _, skipped := range ch.SkippedFrames {
+		require.Equal(t, SkipReasonTruncated, skipped.Reason)
+	}
+	require.NotNil(t, ch.TruncatedPrefix)
+	require.Equal(t, 3, ch.TruncatedPrefix.Frames)
+	require.Equal(t, uint64(3*8), ch.TruncatedPrefix.Size)
+	require.NotEmpty(t, ch.TruncatedPrefix.DecompressError)
+
+	maxFrameNumber = uint16(len(frames) - 1)
+	ch = ProcessFrames(Config{MaxFrameNumber: &maxFrameNumber}, &rollup.Config{}, id, frames)
+	require.False(t, ch.Truncated)
+	require.Nil(t, ch.TruncatedPrefix)
+	require.True(t, ch.IsReady)
+}
+
+func TestProcessFramesDerivedL2Blocks(t *testing.T) {
+	id := derive.ChannelID{0x21}
+	frames := testFrames(10, testChannelFrames(t, id, 64,
+		&derive.SingularBatch{Timestamp: 1010},
+		&derive.SingularBatch{Timestamp: 1012})...)
+	rollupCfg := &rollup.Config{Genesis: rollup.Genesis{L2: eth.BlockID{Number: 100}}}
+
+	ch := ProcessFrames(Config{L2GenesisTime: 1000, L2BlockTime: 2}, rollupCfg, id, frames)
+	require.Equal(t, []uint64{105, 106}, ch.DerivedL2Blocks)
+
+	ch = ProcessFrames(Config{}, rollupCfg, id, frames)
+	require.Empty(t, ch.DerivedL2Blocks)
+}
+
+func TestProcessFramesHexFrameData(t *testing.T) {
+	id := derive.ChannelID{0x28}
+	frames := testFrames(10, derive.Frame{ID: id, Data: []byte{0xab, 0xcd}}, derive.Frame{ID: id, Data: []byte{0xab, 0xcd}, IsLast: true})
+
+	data, err := json.Marshal(ProcessFrames(Config{}, &rollup.Config{}, id, frames))
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"data":"q80="`)
+	require.Contains(t, string(data), `"reason":"conflicting"`)
+
+	data, err = json.Marshal(ProcessFrames(Config{HexFrameData: true}, &rollup.Config{}, id, frames))
+	require.NoError(t, err)
+	require.NotContains(t, string(data), `"data":"q80="`)
+	require.Contains(t, string(data), `"data":"0xabcd"`)
+	require.Contains(t, string(data), `"reason":"conflicting"`)
+	var ch struct {
+		Frames []map[string]any `json:"frames"`
+	}
+	require.NoError(t, json.Unmarshal(data, &ch))
+	require.Equal(t, map[string]any{"id": id.String(), "frame_number": 0.0, "data": "0xabcd", "is_last": false}, ch.Frames[0]["frame"])
+	require.Contains(t, ch.Frames[0], "transaction_hash")
+}
+
+func TestSkippedFrameJSONRoundTrip(t *testing.T) {
+	id := derive.ChannelID{0x29}
+	frames := testFrames(10, derive.Frame{ID: id, Data: []byte{0xab, 0xcd}}, derive.Frame{ID: id, Data: []byte{0xab, 0xcd}, IsLast: true})
+	for _, hexData := range []bool{false, true} {
+		ch := ProcessFrames(Config{HexFrameData: hexData}, &rollup.Config{}, id, frames)
+		require.Len(t, ch.SkippedFrames, 1)
+		data, err := json.Marshal(ch.SkippedFrames[0])
+		require.NoError(t, err)
+		var skipped SkippedFrame
+		require.NoError(t, json.Unmarshal(data, &skipped))
+		require.Equal(t, ch.SkippedFrames[0], skipped)
+
+		data, err = json.Marshal(ch.Frames[0])
+		require.NoError(t, err)
+		var frame FrameWithMetadata
+		require.NoError(t, json.Unmarshal(data, &frame))
+		require.Equal(t, ch.Frames[0], frame)
+	}
+}
+
+func TestProcessFramesOversizedChannel(t *testing.T) {
+	id := derive.ChannelID{0x27}
+	frames := testFrames(10, testChannelFrames(t, id, 1024,
+		&derive.SingularBatch{Timestamp: 1},
+		&derive.SingularBatch{Timestamp: 2, Transactions: []hexutil.Bytes{make([]byte, 200)}})...)
+
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.True(t, ch.IsReady)
+	require.False(t, ch.OversizedChannel)
+	require.Equal(t, rollup.NewChainSpec(&rollup.Config{}).MaxRLPBytesPerChannel(0), ch.MaxRLPBytes)
+	require.Len(t, ch.Batches, 2)
+
+	ch = ProcessFrames(Config{MaxRLPBytesPerChannel: 100}, &rollup.Config{}, id, frames)
+	require.True(t, ch.IsReady)
+	require.True(t, ch.OversizedChannel)
+	require.Equal(t, uint64(100), ch.MaxRLPBytes)
+	// Decompression stops past the limit
+	require.Equal(t, uint64(101), ch.DecompressedSize)
+	require.Len(t, ch.Batches, 1)
+	require.True(t, ch.InvalidBatches)
+	require.NotEmpty(t, ch.DecodeError)
+}
+
+func TestProcessFramesTimestampAnomaly(t *testing.T) {
+	id := derive.ChannelID{0x22}
+	frames := testFrames(10, testChannelFrames(t, id, 64,
+		&derive.SingularBatch{Timestamp: 1010},
+		&derive.SingularBatch{Timestamp: 1012},
+		&derive.SingularBatch{Timestamp: 1012},
+		&derive.SingularBatch{Timestamp: 1016},
+		&derive.SingularBatch{Timestamp: 1018})...)
+
+	ch := ProcessFrames(Config{L2BlockTime: 2}, &rollup.Config{}, id, frames)
+	require.True(t, ch.IsReady)
+	require.Equal(t, []int{2, 3}, ch.TimestampAnomaly)
+
+	ch = ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.Empty(t, ch.TimestampAnomaly)
+}
+
+func TestStatsWriterJSON(t *testing.T) {
+	var buf bytes.Buffer
+	w := &statsWriter{out: &buf, json: true}
+	require.NoError(t, w.WriteChannel(ChannelWithMetadata{IsReady: true, Frames: make([]FrameWithMetadata, 3)}))
+	require.NoError(t, w.Close())
+	var stats Stats
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &stats))
+	require.Equal(t, 1, stats.Channels)
+	require.Equal(t, 3.0, stats.AvgFramesPerChannel)
+}
+
+func TestDiffChannels(t *testing.T) {
+	idA, idB, idC, idD := derive.ChannelID{0x23}, derive.ChannelID{0x24}, derive.ChannelID{0x25}, derive.ChannelID{0x26}
+	batch := func(timestamp uint64) []derive.Batch {
+		return []derive.Batch{&derive.SingularBatch{Timestamp: timestamp}}
+	}
+	a := []ChannelWithMetadata{
+		{ID: idA, IsReady: true, Batches: batch(1)},
+		{ID: idB, IsReady: true, Batches: batch(2)},
+		{ID: idC, IsReady: true, Batches: batch(3)},
+	}
+	b := []ChannelWithMetadata{
+		{ID: idD},
+		{ID: idC, IsReady: true, Batches: batch(4)},
+		{ID: idB, IsReady: true, Batches: batch(2)},
+	}
+	diff := DiffChannels(a, b)
+	require.False(t, diff.Empty())
+	require.Equal(t, []ChannelRef{{ID: idA}}, diff.OnlyInA)
+	require.Equal(t, []ChannelRef{{ID: idD}}, diff.OnlyInB)
+	require.Equal(t, []ChannelDiffEntry{{ID: idC, IsReadyA: true, IsReadyB: true, BatchesDiffer: true}}, diff.Changed)
+	require.True(t, DiffChannels(a, a).Empty())
+
+	// The channels of a reused ID are matched by their reuse index
+	reusedA := []ChannelWithMetadata{
+		{ID: idA, IsReady: true, Batches: batch(1)},
+		{ID: idA, IDReused: true, IDReuseIndex: 1, IsReady: true, Batches: batch(2)},
+	}
+	reusedB := []ChannelWithMetadata{
+		{ID: idA, IDReused: true, IDReuseIndex: 1, IsReady: true, Batches: batch(3)},
+		{ID: idA, IDReused: true, IDReuseIndex: 2},
+		{ID: idA, IsReady: true, Batches: batch(1)},
+	}
+	diff = DiffChannels(reusedA, reusedB)
+	require.Empty(t, diff.OnlyInA)
+	require.Equal(t, []ChannelRef{{ID: idA, IDReuseIndex: 2}}, diff.OnlyInB)
+	require.Equal(t, []ChannelDiffEntry{{ID: idA, IDReuseIndex: 1, IsReadyA: true, IsReadyB: true, BatchesDiffer: true}}, diff.Changed)
+}
+
+func TestProcessFramesOverLimit(t *testing.T) {
+	id := derive.ChannelID{0x27}
+	frames := []FrameWithMetadata{
+		{InclusionBlock: 10, Frame: derive.Frame{ID: id, FrameNumber: 0, Data: []byte{0x01}}},
+		{InclusionBlock: 11, Frame: derive.Frame{ID: id, FrameNumber: 1, Data: []byte{0x02}}},
+		{InclusionBlock: 12, Frame: derive.Frame{ID: id, FrameNumber: 2, Data: []byte{0x03}, IsLast: true}},
+	}
+	ch := ProcessFrames(Config{MaxFramesPerChannel: 2}, &rollup.Config{}, id, frames)
+	require.True(t, ch.OverLimit)
+	require.False(t, ch.IsReady)
+	require.Equal(t, uint64(2), ch.BlockSpan)
+	require.Equal(t, frames[:2], ch.Frames)
+	require.Equal(t, []SkippedFrame{{frames[2], SkipReasonOverLimit}}, ch.SkippedFrames)
+
+	ch = ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.False(t, ch.OverLimit)
+	require.Empty(t, ch.SkippedFrames)
+}
+
+func TestTransactionFramesBlob(t *testing.T) {
+	id := derive.ChannelID{0x29}
+	txm := testTransaction(0, 10, 0, derive.Frame{ID: id, Data: []byte{0x01}})
+	require.False(t, transactionFrames(txm, Config{})[0].Blob)
+
+	txm.Tx = types.NewTx(&types.BlobTx{
+		ChainID:    uint256.NewInt(1),
+		GasTipCap:  uint256.NewInt(1),
+		GasFeeCap:  uint256.NewInt(1),
+		BlobFeeCap: uint256.NewInt(1),
+		To:         testInbox,
+		BlobHashes: []common.Hash{{0x01}},
+	})
+	frames := transactionFrames(txm, Config{})
+	require.Len(t, frames, 1)
+	require.True(t, frames[0].Blob)
+	require.Equal(t, uint64(0), frames[0].CalldataGas)
+}
+
+func TestChannelsFilenameTemplate(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	id := derive.ChannelID{0x2a}
+	writeTransaction(t, in, testTransaction(0, 10, 0, derive.Frame{ID: id, IsLast: true}))
+
+	config := Config{InDirectory: in, OutDirectory: out, FilenameTemplate: "{{.FirstInclusionBlock}}/{{.InboxAddr}}/{{.ID}}.json"}
+	require.NoError(t, runChannels(context.Background(), config, &rollup.Config{}))
+	filename := path.Join("10", testInbox.String(), id.String()+".json")
+	require.FileExists(t, path.Join(out, filename))
+	data, err := os.ReadFile(path.Join(out, IndexFilename))
+	require.NoError(t, err)
+	var index Index
+	require.NoError(t, json.Unmarshal(data, &index))
+	require.Equal(t, filename, index.Channels[0].Filename)
+
+	config.OutDirectory = t.TempDir()
+	config.FilenameTemplate = "../{{.ID}}.json"
+	require.ErrorContains(t, runChannels(context.Background(), config, &rollup.Config{}), "not inside the out directory")
+	config.FilenameTemplate = "{{.Unknown}}"
+	require.ErrorContains(t, runChannels(context.Background(), config, &rollup.Config{}), "failed to render filename")
+}
+
+func TestChannelsFilenameTemplateCollision(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	a, b := derive.ChannelID{0x2a, 0x01}, derive.ChannelID{0x2a, 0x02}
+	writeTransaction(t, in, testTransaction(0, 10, 0, derive.Frame{ID: a, IsLast: true}))
+	writeTransaction(t, in, testTransaction(1, 10, 1, derive.Frame{ID: b, IsLast: true}))
+
+	// Both channels are first included in block 10, so they render the same filename
+	config := Config{InDirectory: in, OutDirectory: out, FilenameTemplate: "{{.FirstInclusionBlock}}.json", ContinueOnError: true}
+	result, err := Channels(context.Background(), config, &rollup.Config{})
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Channels)
+	data, err := os.ReadFile(path.Join(out, IndexFilename))
+	require.NoError(t, err)
+	var index Index
+	require.NoError(t, json.Unmarshal(data, &index))
+	require.Len(t, index.Channels, 1)
+	// The index points at the channel in the file
+	data, err = os.ReadFile(path.Join(out, "10.json"))
+	require.NoError(t, err)
+	var ch struct {
+		ID derive.ChannelID `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(data, &ch))
+	require.Equal(t, index.Channels[0].ID, ch.ID)
+
+	config.ContinueOnError = false
+	config.OutDirectory = t.TempDir()
+	require.ErrorContains(t, runChannels(context.Background(), config, &rollup.Config{}), "is already used by channel")
+}
+
+func TestProcessFramesLateFrames(t *testing.T) {
+	id := derive.ChannelID{0x2b}
+	frames := []FrameWithMetadata{
+		{InclusionBlock: 10, Frame: derive.Frame{ID: id, FrameNumber: 0, Data: []byte{0x01}}},
+		{InclusionBlock: 11, Frame: derive.Frame{ID: id, FrameNumber: 2, Data: []byte{0x03}, IsLast: true}},
+		{InclusionBlock: 12, Frame: derive.Frame{ID: id, FrameNumber: 1, Data: []byte{0x02}}},
+		{InclusionBlock: 13, Frame: derive.Frame{ID: id, FrameNumber: 0, Data: []byte{0x01}}},
+	}
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.True(t, ch.IsReady)
+	require.Equal(t, []FrameWithMetadata{frames[2]}, ch.LateFrames)
+	// Frames skipped after the closing frame are no late frames
+	require.Equal(t, []SkippedFrame{{frames[3], SkipReasonChannelReady}}, ch.SkippedFrames)
+}
+
+func TestProcessFramesTrace(t *testing.T) {
+	id := derive.ChannelID{0x2c}
+	frames := testFrames(10,
+		derive.Frame{ID: id, FrameNumber: 0, Data: []byte{0x01}},
+		derive.Frame{ID: id, FrameNumber: 0, Data: []byte{0x01}},
+		derive.Frame{ID: id, FrameNumber: 1, Data: []byte{0x02}, IsLast: true})
+
+	lgr, logs := testlog.CaptureLogger(t, log.LevelInfo)
+	ProcessFrames(Config{Log: lgr}, &rollup.Config{}, id, frames)
+	require.Empty(t, logs.FindLogs(testlog.NewMessageFilter("Frame decision")))
+
+	ProcessFrames(Config{Log: lgr, Trace: true}, &rollup.Config{}, id, frames)
+	var decisions []string
+	for _, record := range logs.FindLogs(testlog.NewMessageFilter("Frame decision")) {
+		decisions = append(decisions, record.AttrValue("decision").(string))
+	}
+	require.Equal(t, []string{FrameDecisionAccepted, SkipReasonDuplicate, FrameDecisionClosed}, decisions)
+}
+
+func TestChannelsBatchOutDirectory(t *testing.T) {
+	in, out, batchOut := t.TempDir(), t.TempDir(), t.TempDir()
+	id := derive.ChannelID{0x2d}
+	batches := []derive.InnerBatchData{
+		&derive.SingularBatch{ParentHash: common.Hash{0xaa}, EpochNum: 7, EpochHash: common.Hash{0xbb}, Timestamp: 1000,
+			Transactions: []hexutil.Bytes{{0x01}, {0x02}}},
+		&derive.SingularBatch{ParentHash: common.Hash{0xcc}, EpochNum: 7, EpochHash: common.Hash{0xbb}, Timestamp: 1002},
+	}
+	writeTransaction(t, in, testTransaction(0, 10, 0, testChannelFrames(t, id, 1000, batches...)...))
+
+	config := Config{InDirectory: in, OutDirectory: out, BatchOutDirectory: batchOut}
+	require.NoError(t, runChannels(context.Background(), config, &rollup.Config{}))
+	entries, err := os.ReadDir(batchOut)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	data, err := os.ReadFile(path.Join(batchOut, id.String()+"_0.json"))
+	require.NoError(t, err)
+	var summary BatchSummary
+	require.NoError(t, json.Unmarshal(data, &summary))
+	epochHash := common.Hash{0xbb}
+	require.Equal(t, BatchSummary{
+		ChannelID:        id,
+		BatchType:        derive.SingularBatchType,
+		ParentHash:       common.Hash{0xaa}.Bytes(),
+		EpochNum:         7,
+		EpochHash:        &epochHash,
+		Timestamp:        1000,
+		BlockCount:       1,
+		TransactionCount: 2,
+	}, summary)
+}
+
+func TestProcessFramesMaxFrameNumberBoundary(t *testing.T) {
+	id := derive.ChannelID{0x2e}
+	frames := []FrameWithMetadata{
+		{InclusionBlock: 10, Frame: derive.Frame{ID: id, FrameNumber: math.MaxUint16 - 1, Data: []byte{0x01}}},
+		{InclusionBlock: 12, Frame: derive.Frame{ID: id, FrameNumber: math.MaxUint16, Data: []byte{0x02}}},
+	}
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.True(t, ch.MaxFrameReached)
+	require.False(t, ch.IsReady)
+	require.Equal(t, uint16(math.MaxUint16), *ch.HighestFrameNumber)
+	require.Len(t, ch.MissingFrameNumbers, math.MaxUint16-1)
+	require.Equal(t, uint16(math.MaxUint16-2), ch.MissingFrameNumbers[len(ch.MissingFrameNumbers)-1])
+	require.Equal(t, uint64(2), ch.MaxInclusionGap)
+
+	// Closing the channel at the maximum frame number does not wrap around
+	frames[1].Frame.IsLast = true
+	ch = ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.True(t, ch.Closed)
+	require.True(t, ch.MaxFrameReached)
+	require.False(t, ch.IsReady)
+	require.Len(t, ch.MissingFrameNumbers, math.MaxUint16-1)
+
+	ch = ProcessFrames(Config{}, &rollup.Config{}, id, frames[:1])
+	require.False(t, ch.MaxFrameReached)
+}
+
+func TestChannelsWriteTransactions(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	idA, idB := derive.ChannelID{0x2f}, derive.ChannelID{0x30}
+	shared := testTransaction(1, 11, 0, derive.Frame{ID: idA, FrameNumber: 1, IsLast: true}, derive.Frame{ID: idB})
+	first := testTransaction(0, 10, 0, derive.Frame{ID: idA})
+	writeTransaction(t, in, shared)
+	writeTransaction(t, in, first)
+
+	require.NoError(t, runChannels(context.Background(), Config{InDirectory: in, OutDirectory: out, WriteTransactions: true}, &rollup.Config{}))
+	data, err := os.ReadFile(path.Join(out, TransactionsFilename))
+	require.NoError(t, err)
+	var entries []TransactionEntry
+	require.NoError(t, json.Unmarshal(data, &entries))
+	require.Equal(t, []TransactionEntry{
+		{TxHash: first.Tx.Hash(), BlockNumber: 10, InboxAddr: testInbox, Frames: []TransactionFrame{{ChannelID: idA}}},
+		{TxHash: shared.Tx.Hash(), BlockNumber: 11, InboxAddr: testInbox, Frames: []TransactionFrame{
+			{ChannelID: idA, FrameNumber: 1},
+			{ChannelID: idB},
+		}},
+	}, entries)
+
+	out = t.TempDir()
+	require.NoError(t, runChannels(context.Background(), Config{InDirectory: in, OutDirectory: out}, &rollup.Config{}))
+	require.NoFileExists(t, path.Join(out, TransactionsFilename))
+}
+
+func TestProcessFramesTruncatedData(t *testing.T) {
+	id := derive.ChannelID{0x31}
+	var calldata bytes.Buffer
+	calldata.WriteByte(derive.DerivationVersion0)
+	frame := derive.Frame{ID: id, Data: []byte{0x01, 0x02, 0x03}, IsLast: true}
+	require.NoError(t, frame.MarshalBinary(&calldata))
+	txm := testTransaction(0, 10, 0, frame)
+	txm.Tx = types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(1), To: &testInbox, Data: calldata.Bytes()})
+
+	frames := transactionFrames(txm, Config{})
+	require.Equal(t, 3, *frames[0].DeclaredLen)
+	ch := ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.True(t, ch.IsReady)
+	require.Empty(t, ch.TruncatedFrames)
+
+	txm.Frames[0].Data = []byte{0x01}
+	frames = transactionFrames(txm, Config{})
+	ch = ProcessFrames(Config{}, &rollup.Config{}, id, frames)
+	require.False(t, ch.IsReady)
+	require.True(t, ch.InvalidFrames)
+	require.Equal(t, frames, ch.TruncatedFrames)
+	require.Equal(t, []SkippedFrame{{frames[0], SkipReasonTruncatedData}}, ch.SkippedFrames)
+}
+
+type memoryObjectStore map[string][]byte
+
+func (s memoryObjectStore) List(_ context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for key := range s {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+func (s memoryObjectStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(s[key])), nil
+}
+
+func TestChannelsObjectStoreSource(t *testing.T) {
+	id := derive.ChannelID{0x32}
+	txm := testTransaction(0, 10, 0, derive.Frame{ID: id, IsLast: true})
+	data, err := json.Marshal(txm)
+	require.NoError(t, err)
+	store := memoryObjectStore{
+		"archive/tx.json":        data,
+		"archive/tx.json.sha256": []byte("ignored"),
+		"archive/corrupt.json":   []byte("{not json"),
+		"other/tx.json":          data,
+	}
+	out := t.TempDir()
+	config := Config{Source: &ObjectStoreSource{Store: store, Prefix: "archive/"}, OutDirectory: out}
+	_, err = Channels(context.Background(), config, &rollup.Config{})
+	require.ErrorContains(t, err, "archive/corrupt.json")
+	require.FileExists(t, path.Join(out, id.String()+".json"))
+}
+
+func TestObjectStoreSourceChecksums(t *testing.T) {
+	txm := testTransaction(0, 10, 0, derive.Frame{ID: derive.ChannelID{0x3c}, IsLast: true})
+	data, err := json.Marshal(txm)
+	require.NoError(t, err)
+	sum := sha256.Sum256(data)
+	store := memoryObjectStore{
+		"tx.json":              data,
+		"tx.json.sha256":       []byte(hex.EncodeToString(sum[:]) + "  tx.json\n"),
+		"mismatch.json":        data,
+		"mismatch.json.sha256": []byte(hex.EncodeToString(make([]byte, sha256.Size))),
+		"unverified.json":      data,
+	}
+	var progress []int
+	source := &ObjectStoreSource{Store: store, VerifyChecksums: true, ProgressFunc: func(done, total int) {
+		require.Equal(t, len(store), total)
+		progress = append(progress, done)
+	}}
+	txns, err := source.Load(context.Background(), keepAll)
+	require.Len(t, txns, 2)
+	var checksumErr *ChecksumError
+	require.ErrorAs(t, err, &checksumErr)
+	require.Equal(t, "mismatch.json", checksumErr.File)
+	require.Len(t, progress, 3)
+
+	source.VerifyChecksums = false
+	txns, err = source.Load(context.Background(), keepAll)
+	require.NoError(t, err)
+	require.Len(t, txns, 3)
+}
+
+func keepAll(fetch.TransactionWithMetadata) bool {
+	return true
+}
+
+func TestParseS3URL(t *testing.T) {
+	bucket, prefix, ok, err := parseS3URL("s3://archive/op-mainnet/txs")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "archive", bucket)
+	require.Equal(t, "op-mainnet/txs", prefix)
+
+	_, _, ok, err = parseS3URL("/tmp/batch_decoder")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, _, _, err = parseS3URL("s3:///prefix")
+	require.ErrorContains(t, err, "missing bucket")
+}
+
+func TestChannelsPrettyPrint(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	id := derive.ChannelID{0x33}
+	writeTransaction(t, in, testTransaction(0, 10, 0, derive.Frame{ID: id, IsLast: true}))
+	writeTransaction(t, in, testTransaction(1, 11, 0, derive.Frame{ID: derive.ChannelID{0x34}}))
+
+	require.NoError(t, runChannels(context.Background(), Config{InDirectory: in, OutDirectory: out, PrettyPrint: true}, &rollup.Config{}))
+	for _, name := range []string{id.String() + ".json", IndexFilename, ErrorsFilename} {
+		data, err := os.ReadFile(path.Join(out, name))
+		require.NoError(t, err)
+		require.Contains(t, string(data), "\n  \"", name)
+	}
+
+	single := path.Join(t.TempDir(), "channels.json")
+	require.NoError(t, runChannels(context.Background(), Config{InDirectory: in, SingleFile: single, PrettyPrint: true}, &rollup.Config{}))
+	data, err := os.ReadFile(single)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(data), "[\n  {\n    \"schema_version\""))
+	var channels []json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &channels))
+	require.Len(t, channels, 2)
+}
+
+func TestProcessFramesReplay(t *testing.T) {
+	id := derive.ChannelID{0x35}
+	batch := &derive.SingularBatch{ParentHash: common.Hash{0x03}, Timestamp: 100}
+	frames := testFrames(10, testChannelFrames(t, id, 8, batch)...)
+	rollupCfg := &rollup.Config{ChannelTimeoutBedrock: 50}
+
+	ch := ProcessFrames(Config{Replay: true}, rollupCfg, id, frames)
+	require.True(t, ch.IsReady)
+	require.Equal(t, &ReplayResult{Ready: true, Agrees: true}, ch.Replay)
+
+	// The channel bank drops the channel once the last frame is included past the timeout
+	frames[len(frames)-1].InclusionBlock = 100
+	ch = ProcessFrames(Config{Replay: true}, rollupCfg, id, frames)
+	require.True(t, ch.IsReady)
+	require.Equal(t, &ReplayResult{Ready: false, Agrees: false}, ch.Replay)
+	ch = ProcessFrames(Config{Replay: true, ChannelTimeout: 50}, rollupCfg, id, frames)
+	require.False(t, ch.IsReady)
+	require.Equal(t, &ReplayResult{Ready: false, Agrees: true}, ch.Replay)
+
+	require.Nil(t, ProcessFrames(Config{}, rollupCfg, id, frames).Replay)
+}
+
+func TestNonceGaps(t *testing.T) {
+	batcherA, batcherB := common.Address{0xa0}, common.Address{0xb0}
+	tx := func(sender common.Address, nonce, block uint64) fetch.TransactionWithMetadata {
+		txm := testTransaction(nonce, block, 0)
+		txm.Sender = sender
+		return txm
+	}
+	txns := []fetch.TransactionWithMetadata{
+		tx(batcherB, 7, 30),
+		tx(batcherA, 0, 10),
+		tx(batcherA, 4, 14),
+		tx(batcherA, 1, 11),
+		tx(batcherB, 5, 20),
+		tx(batcherB, 5, 21),
+	}
+	require.Equal(t, []NonceGap{
+		{Sender: batcherA, FirstMissing: 2, LastMissing: 3, BlockBefore: 11, BlockAfter: 14},
+		{Sender: batcherB, FirstMissing: 6, LastMissing: 6, BlockBefore: 21, BlockAfter: 30},
+	}, nonceGaps(txns))
+
+	stats := Stats{NonceGaps: nonceGaps(txns)}
+	require.Contains(t, stats.String(), "Nonce gaps:                    2\n")
+	require.Contains(t, stats.String(), "nonces 2-3 missing between blocks 11 and 14")
+}
+
+func TestTxIndexAnomalies(t *testing.T) {
+	batcherA, batcherB := common.Address{0xa0}, common.Address{0xb0}
+	tx := func(sender common.Address, nonce, block, index uint64) fetch.TransactionWithMetadata {
+		txm := testTransaction(nonce, block, index)
+		txm.Sender = sender
+		return txm
+	}
+	txns := []fetch.TransactionWithMetadata{
+		tx(batcherA, 0, 10, 1),
+		tx(batcherB, 0, 10, 4),
+		tx(batcherA, 1, 10, 7),
+		tx(batcherA, 3, 11, 2),
+		tx(batcherB, 1, 11, 2),
+		tx(batcherA, 2, 11, 5),
+		tx(batcherA, 4, 12, 0),
+	}
+	require.Equal(t, []TxIndexAnomaly{
+		{BlockNumber: 11, TxIndex: 2, TxHash: txns[4].Tx.Hash(), PrevTxHash: txns[3].Tx.Hash(), Reason: TxIndexAnomalyDuplicate},
+		{BlockNumber: 11, TxIndex: 5, TxHash: txns[5].Tx.Hash(), PrevTxHash: txns[3].Tx.Hash(), Reason: TxIndexAnomalyNonceOrder},
+	}, txIndexAnomalies(txns))
+}
+
+func TestChannelsNDJSONOutput(t *testing.T) {
+	in := t.TempDir()
+	ids := []derive.ChannelID{{0x36}, {0x37}}
+	for i, id := range ids {
+		writeTransaction(t, in, testTransaction(uint64(i), 10+uint64(i), 0, derive.Frame{ID: id, IsLast: true}))
+	}
+	var buf bytes.Buffer
+	config := Config{InDirectory: in, OutputFormat: OutputFormatNDJSON, Output: &buf, Concurrency: 1}
+	require.NoError(t, runChannels(context.Background(), config, &rollup.Config{}))
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, len(ids))
+	for i, line := range lines {
+		var ch struct {
+			ID derive.ChannelID `json:"id"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(line), &ch))
+		require.Equal(t, ids[i], ch.ID)
+	}
+
+	file := path.Join(t.TempDir(), "channels.ndjson")
+	config = Config{InDirectory: in, OutputFormat: OutputFormatNDJSON, SingleFile: file}
+	require.NoError(t, runChannels(context.Background(), config, &rollup.Config{}))
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.Equal(t, len(ids), bytes.Count(data, []byte("\n")))
+}
+
+func TestChannelsStdout(t *testing.T) {
+	in := t.TempDir()
+	ids := []derive.ChannelID{{0x38}, {0x39}}
+	for i, id := range ids {
+		writeTransaction(t, in, testTransaction(uint64(i), 10+uint64(i), 0, derive.Frame{ID: id, IsLast: true}))
+	}
+	var buf bytes.Buffer
+	out := path.Join(t.TempDir(), "out")
+	config := Config{InDirectory: in, OutDirectory: out, Stdout: true, Output: &buf, ChannelIDs: ids[1:]}
+	require.NoError(t, runChannels(context.Background(), config, &rollup.Config{}))
+	var ch ChannelWithMetadata
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &ch))
+	require.Equal(t, ids[1], ch.ID)
+	require.NoDirExists(t, out)
+
+	// Multiple channels are written line by line
+	buf.Reset()
+	config.ChannelIDs = nil
+	require.NoError(t, runChannels(context.Background(), config, &rollup.Config{}))
+	require.Equal(t, len(ids), bytes.Count(buf.Bytes(), []byte("\n")))
+
+	config.OutputFormat = OutputFormatCSV
+	require.ErrorContains(t, runChannels(context.Background(), config, &rollup.Config{}), "stdout")
+	config.OutputFormat, config.SingleFile = "", path.Join(t.TempDir(), "channels.json")
+	require.ErrorContains(t, runChannels(context.Background(), config, &rollup.Config{}), "stdout")
+}
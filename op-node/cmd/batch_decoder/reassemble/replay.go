@@ -0,0 +1,74 @@
+package reassemble
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/ethereum-optimism/optimism/op-node/metrics"
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+// ReplayResult is the outcome of feeding the frames of a channel through the derivation
+// pipeline's channel bank, see Config.Replay.
+type ReplayResult struct {
+	// Ready is true if the channel bank emitted the channel data
+	Ready bool `json:"ready"`
+	// Agrees is true if Ready equals ChannelWithMetadata.IsReady & the data emitted by the channel bank
+	// equals the manually assembled channel data
+	Agrees bool `json:"agrees"`
+}
+
+// replayFrames provides the frames of a single channel to the channel bank, moving the L1 origin
+// to the inclusion block of each frame.
+type replayFrames struct {
+	frames []FrameWithMetadata
+	origin eth.L1BlockRef
+}
+
+func (r *replayFrames) NextFrame(_ context.Context) (derive.Frame, error) {
+	if len(r.frames) == 0 {
+		return derive.Frame{}, io.EOF
+	}
+	frame := r.frames[0]
+	r.frames = r.frames[1:]
+	r.origin = eth.L1BlockRef{Hash: frame.BlockHash, Number: frame.InclusionBlock, Time: frame.Timestamp}
+	return frame.Frame, nil
+}
+
+func (r *replayFrames) Origin() eth.L1BlockRef {
+	return r.origin
+}
+
+// replayChannel feeds the frames, in inclusion order, through a derive.ChannelBank & returns the
+// channel data it emits, or nil if it never emits the channel. Each channel is replayed in isolation,
+// so the pruning of the channel bank & the blocking by other channels before Canyon are not modeled.
+func replayChannel(rollupCfg *rollup.Config, frames []FrameWithMetadata) []byte {
+	prev := &replayFrames{frames: frames}
+	bank := derive.NewChannelBank(log.NewLogger(log.DiscardHandler()), rollupCfg, prev, metrics.NoopMetrics)
+	for {
+		data, err := bank.NextData(context.Background())
+		if err == io.EOF {
+			return nil
+		} else if errors.Is(err, derive.NotEnoughData) || (err == nil && data == nil) {
+			// A frame was ingested, or a timed out channel was dropped
+			continue
+		} else if err != nil {
+			return nil
+		}
+		return data
+	}
+}
+
+func newReplayResult(isReady bool, assembled []byte, replayed []byte) *ReplayResult {
+	ready := replayed != nil
+	return &ReplayResult{
+		Ready:  ready,
+		Agrees: ready == isReady && (!ready || bytes.Equal(replayed, assembled)),
+	}
+}
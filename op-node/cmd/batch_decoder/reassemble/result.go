@@ -0,0 +1,30 @@
+package reassemble
+
+// Result summarizes a run of Channels. It complements the written output, e.g. to assert the outcome
+// of a run in tests or to report it without reading the output back. Channels which failed to write
+// are not counted.
+type Result struct {
+	Channels      int `json:"channels"`
+	ReadyChannels int `json:"ready_channels"`
+	// InvalidChannels is the number of channels with invalid frames or batches
+	InvalidChannels int `json:"invalid_channels"`
+	Frames          int `json:"frames"`
+	SkippedFrames   int `json:"skipped_frames"`
+	// BytesWritten is the size of the channel output, excluding the reports written alongside it.
+	BytesWritten int64 `json:"bytes_written"`
+	// Errors are the entries of the error manifest, whether or not it was written
+	Errors []ChannelErrorEntry `json:"errors"`
+}
+
+// add counts the channel & records its error entry, if any.
+func (r *Result) add(ch ChannelWithMetadata) {
+	r.Channels++
+	if ch.IsReady {
+		r.ReadyChannels++
+	}
+	if ch.InvalidFrames || ch.InvalidBatches {
+		r.InvalidChannels++
+	}
+	r.Frames += len(ch.Frames)
+	r.SkippedFrames += len(ch.SkippedFrames)
+}
@@ -0,0 +1,53 @@
+package reassemble
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// encodeBatches re-encodes decoded batches into the uncompressed channel payload, the same way
+// derive.SingularChannelOut & derive.SpanChannelOut encode batches before compressing them.
+func encodeBatches(batches []derive.Batch) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, batch := range batches {
+		var inner derive.InnerBatchData
+		switch b := batch.(type) {
+		case *derive.SingularBatch:
+			inner = b
+		case *derive.SpanBatch:
+			raw, err := b.ToRawSpanBatch()
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert span batch %d: %w", i, err)
+			}
+			inner = raw
+		default:
+			return nil, fmt.Errorf("unsupported batch %d of type %T", i, batch)
+		}
+		if err := rlp.Encode(&buf, derive.NewBatchData(inner)); err != nil {
+			return nil, fmt.Errorf("failed to encode batch %d: %w", i, err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// verifyRoundTrip re-encodes the batches & compares the result with the decompressed channel payload.
+// The compressed frame data is not compared, because it depends on the compression level & settings
+// of the batcher. Returns whether both match & a summary of the difference otherwise.
+func verifyRoundTrip(batches []derive.Batch, decompressed []byte) (bool, string) {
+	encoded, err := encodeBatches(batches)
+	if err != nil {
+		return false, err.Error()
+	}
+	if bytes.Equal(encoded, decompressed) {
+		return true, ""
+	}
+	offset := 0
+	for offset < len(encoded) && offset < len(decompressed) && encoded[offset] == decompressed[offset] {
+		offset++
+	}
+	return false, fmt.Sprintf("re-encoded %d bytes, channel payload has %d bytes, first difference at offset %d",
+		len(encoded), len(decompressed), offset)
+}
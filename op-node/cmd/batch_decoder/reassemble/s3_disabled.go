@@ -0,0 +1,12 @@
+//go:build !s3
+// +build !s3
+
+package reassemble
+
+import "errors"
+
+// newS3Store fails in builds without the s3 build tag, so that the S3 client is only linked into
+// builds which need it.
+func newS3Store(cfg S3Config, bucket string) (ObjectStore, error) {
+	return nil, errors.New("s3 input requires a build with the s3 build tag")
+}
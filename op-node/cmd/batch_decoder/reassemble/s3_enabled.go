@@ -0,0 +1,50 @@
+//go:build s3
+// +build s3
+
+package reassemble
+
+import (
+	"context"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Store is an ObjectStore backed by a bucket of an S3-compatible object store.
+type S3Store struct {
+	bucket string
+	client *minio.Client
+}
+
+var _ ObjectStore = (*S3Store)(nil)
+
+func NewS3Store(cfg S3Config, bucket string) (*S3Store, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKeyID, cfg.AccessKeySecret, ""),
+		Secure: !cfg.Insecure,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3Store{bucket: bucket, client: client}, nil
+}
+
+func newS3Store(cfg S3Config, bucket string) (ObjectStore, error) {
+	return NewS3Store(cfg, bucket)
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		keys = append(keys, obj.Key)
+	}
+	return keys, nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+}
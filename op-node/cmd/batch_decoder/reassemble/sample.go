@@ -0,0 +1,28 @@
+package reassemble
+
+import "math/rand"
+
+// sampleIndices selects count of the indices [0, n) by reservoir sampling. The sample only depends on
+// the seed, so that it is reproducible, although channels are processed concurrently.
+func sampleIndices(n, count int, seed int64) map[int]bool {
+	rng := rand.New(rand.NewSource(seed))
+	reservoir := make([]int, 0, min(n, count))
+	for i := 0; i < n; i++ {
+		if i < count {
+			reservoir = append(reservoir, i)
+		} else if j := rng.Intn(i + 1); j < count {
+			reservoir[j] = i
+		}
+	}
+	sampled := make(map[int]bool, len(reservoir))
+	for _, i := range reservoir {
+		sampled[i] = true
+	}
+	return sampled
+}
+
+// omitChannel returns true if the channel is not written by a writer, but only counted in its
+// statistics & error manifest, because it was not sampled or is not ready with readyOnly.
+func omitChannel(readyOnly bool, ch ChannelWithMetadata) bool {
+	return ch.unsampled || (readyOnly && !ch.IsReady)
+}
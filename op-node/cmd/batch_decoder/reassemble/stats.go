@@ -0,0 +1,143 @@
+package reassemble
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Stats aggregates metrics over all re-assembled channels.
+type Stats struct {
+	Channels             int `json:"channels"`
+	ReadyChannels        int `json:"ready_channels"`
+	InvalidFrameChannels int `json:"invalid_frame_channels"`
+	Frames               int `json:"frames"`
+	SkippedFrames        int `json:"skipped_frames"`
+	// DuplicateFrames, ConflictingFrames, PastChannelEndFrames, DoubleCloseFrames & PrunedFrames count the
+	// skipped frames of all channels by reason, to surface systemic batcher misbehavior.
+	DuplicateFrames      int `json:"duplicate_frames"`
+	ConflictingFrames    int `json:"conflicting_frames"`
+	PastChannelEndFrames int `json:"past_channel_end_frames"`
+	DoubleCloseFrames    int `json:"double_close_frames"`
+	PrunedFrames         int `json:"pruned_frames"`
+	PreBedrockFrames     int `json:"pre_bedrock_frames"`
+	// MultiCloseChannels is the number of channels with more than one closing frame
+	MultiCloseChannels int `json:"multi_close_channels"`
+	// CompressedBytes & DecompressedBytes are the total channel data sizes
+	CompressedBytes      uint64 `json:"compressed_bytes"`
+	DecompressedBytes    uint64 `json:"decompressed_bytes"`
+	DecompressedChannels int    `json:"decompressed_channels"`
+	// L2Txns is the total number of L2 transactions in the batches of all channels
+	L2Txns int `json:"l2_txns"`
+
+	// ReadyRatio, AvgFramesPerChannel & AvgCompressionRatio are derived from the other
+	// metrics by finalize. The compression ratio is averaged over the decompressed channels.
+	ReadyRatio          float64 `json:"ready_ratio"`
+	AvgFramesPerChannel float64 `json:"avg_frames_per_channel"`
+	AvgCompressionRatio float64 `json:"avg_compression_ratio"`
+
+	// InvalidChannelIDFrames is the number of frames with a zero channel ID, which are not part of any channel
+	InvalidChannelIDFrames int `json:"invalid_channel_id_frames"`
+	// SubmissionCadence is the distribution of block gaps between the loaded transactions of valid batchers.
+	// It is nil if less than two transactions were loaded.
+	SubmissionCadence *SubmissionCadence `json:"submission_cadence,omitempty"`
+	// NonceGaps are the gaps in the nonces of the loaded transactions of each valid batcher
+	NonceGaps []NonceGap `json:"nonce_gaps,omitempty"`
+	// TxIndexAnomalies are the loaded transactions whose index contradicts the other transactions of their block
+	TxIndexAnomalies []TxIndexAnomaly `json:"tx_index_anomalies,omitempty"`
+
+	compressionRatioSum float64
+}
+
+func (s *Stats) add(ch ChannelWithMetadata) {
+	s.Channels++
+	if ch.IsReady {
+		s.ReadyChannels++
+	}
+	if ch.InvalidFrames {
+		s.InvalidFrameChannels++
+	}
+	s.Frames += len(ch.Frames)
+	s.SkippedFrames += len(ch.SkippedFrames)
+	if ch.ClosingFrameCount > 1 {
+		s.MultiCloseChannels++
+	}
+	s.L2Txns += ch.TotalL2Txns
+	s.CompressedBytes += ch.CompressedSize
+	if ch.Decompressed {
+		s.DecompressedChannels++
+		s.DecompressedBytes += ch.DecompressedSize
+		s.compressionRatioSum += ch.CompressionRatio
+	}
+	for _, frame := range ch.SkippedFrames {
+		switch frame.Reason {
+		case SkipReasonDuplicate:
+			s.DuplicateFrames++
+		case SkipReasonConflicting:
+			s.ConflictingFrames++
+		case SkipReasonPastChannelEnd:
+			s.PastChannelEndFrames++
+		case SkipReasonChannelAlreadyClosed:
+			s.DoubleCloseFrames++
+		case SkipReasonPrunedByClose:
+			s.PrunedFrames++
+		case SkipReasonPreBedrock:
+			s.PreBedrockFrames++
+		}
+	}
+}
+
+// finalize computes the derived metrics. It must be called after all channels are added.
+func (s *Stats) finalize() {
+	if s.Channels > 0 {
+		s.ReadyRatio = float64(s.ReadyChannels) / float64(s.Channels)
+		s.AvgFramesPerChannel = float64(s.Frames) / float64(s.Channels)
+	}
+	if s.DecompressedChannels > 0 {
+		s.AvgCompressionRatio = s.compressionRatioSum / float64(s.DecompressedChannels)
+	}
+}
+
+// String formats the statistics as a human readable summary.
+func (s Stats) String() string {
+	rows := []struct {
+		label string
+		value any
+	}{
+		{"Channels", s.Channels},
+		{"Ready channels", s.ReadyChannels},
+		{"Channels with invalid frames", s.InvalidFrameChannels},
+		{"Frames", s.Frames},
+		{"Skipped frames", s.SkippedFrames},
+		{"Duplicate frames", s.DuplicateFrames},
+		{"Conflicting frames", s.ConflictingFrames},
+		{"Past channel end frames", s.PastChannelEndFrames},
+		{"Double close frames", s.DoubleCloseFrames},
+		{"Pruned frames", s.PrunedFrames},
+		{"Pre-Bedrock frames", s.PreBedrockFrames},
+		{"Multi-close channels", s.MultiCloseChannels},
+		{"Invalid channel ID frames", s.InvalidChannelIDFrames},
+		{"Compressed bytes", s.CompressedBytes},
+		{"Decompressed bytes", s.DecompressedBytes},
+		{"L2 transactions", s.L2Txns},
+		{"Ready ratio", fmt.Sprintf("%.3f", s.ReadyRatio)},
+		{"Avg frames per channel", fmt.Sprintf("%.2f", s.AvgFramesPerChannel)},
+		{"Avg compression ratio", fmt.Sprintf("%.3f", s.AvgCompressionRatio)},
+	}
+	var b strings.Builder
+	for _, row := range rows {
+		fmt.Fprintf(&b, "%-30s %v\n", row.label+":", row.value)
+	}
+	if c := s.SubmissionCadence; c != nil {
+		fmt.Fprintf(&b, "%-30s min %d, max %d, mean %.2f, median %.1f blocks\n", "Submission gaps:",
+			c.MinGap, c.MaxGap, c.MeanGap, c.MedianGap)
+	}
+	fmt.Fprintf(&b, "%-30s %v\n", "Nonce gaps:", len(s.NonceGaps))
+	for _, gap := range s.NonceGaps {
+		fmt.Fprintf(&b, "  %v: nonces %d-%d missing between blocks %d and %d\n",
+			gap.Sender, gap.FirstMissing, gap.LastMissing, gap.BlockBefore, gap.BlockAfter)
+	}
+	if len(s.TxIndexAnomalies) > 0 {
+		fmt.Fprintf(&b, "%-30s %v\n", "Transaction index anomalies:", len(s.TxIndexAnomalies))
+	}
+	return b.String()
+}
@@ -0,0 +1,52 @@
+package reassemble
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// phaseTimer records the wall-clock duration of the phases of a run for Config.Timing.
+// All methods are no-ops if timing is disabled.
+type phaseTimer struct {
+	enabled bool
+	last    time.Time
+	phases  []any
+	// writes is the total duration of all channel writes in nanoseconds. Channels are written
+	// concurrently, so it may exceed the wall-clock duration of the processing phase.
+	writes atomic.Int64
+}
+
+func newPhaseTimer(enabled bool) *phaseTimer {
+	return &phaseTimer{enabled: enabled, last: time.Now()}
+}
+
+// done ends the current phase, which started when the previous phase ended.
+func (t *phaseTimer) done(phase string) {
+	if !t.enabled {
+		return
+	}
+	now := time.Now()
+	t.phases = append(t.phases, phase, now.Sub(t.last))
+	t.last = now
+}
+
+// timeWrite runs the write & adds its duration to the total write duration.
+func (t *phaseTimer) timeWrite(write func()) {
+	if !t.enabled {
+		write()
+		return
+	}
+	start := time.Now()
+	write()
+	t.writes.Add(int64(time.Since(start)))
+}
+
+// log prints the breakdown of all ended phases.
+func (t *phaseTimer) log(lgr log.Logger) {
+	if !t.enabled {
+		return
+	}
+	lgr.Info("Timing", append(t.phases, "total_write", time.Duration(t.writes.Load()))...)
+}
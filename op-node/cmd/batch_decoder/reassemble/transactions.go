@@ -0,0 +1,45 @@
+package reassemble
+
+import (
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TransactionsFilename is the name of the file listing the frames carried by each batcher transaction.
+const TransactionsFilename = "transactions.json"
+
+// TransactionEntry lists the frames carried by a single batcher transaction.
+type TransactionEntry struct {
+	TxHash      common.Hash        `json:"transaction_hash"`
+	BlockNumber uint64             `json:"block_number"`
+	TxIndex     uint64             `json:"tx_index"`
+	InboxAddr   common.Address     `json:"inbox_address"`
+	Frames      []TransactionFrame `json:"frames"`
+}
+
+// TransactionFrame identifies a frame carried by a transaction.
+type TransactionFrame struct {
+	ChannelID   derive.ChannelID `json:"channel_id"`
+	FrameNumber uint16           `json:"frame_number"`
+}
+
+// transactionEntries lists the frames of each transaction, in the order of the transactions.
+// Like blockFramesEntries, it uses the frames decoded by the fetch command.
+func transactionEntries(txns []fetch.TransactionWithMetadata) []TransactionEntry {
+	entries := make([]TransactionEntry, 0, len(txns))
+	for _, tx := range txns {
+		entry := TransactionEntry{
+			TxHash:      tx.Tx.Hash(),
+			BlockNumber: tx.BlockNumber,
+			TxIndex:     tx.TxIndex,
+			InboxAddr:   tx.InboxAddr,
+			Frames:      []TransactionFrame{},
+		}
+		for _, frame := range tx.Frames {
+			entry.Frames = append(entry.Frames, TransactionFrame{ChannelID: frame.ID, FrameNumber: frame.FrameNumber})
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
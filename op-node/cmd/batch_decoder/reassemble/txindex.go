@@ -0,0 +1,62 @@
+package reassemble
+
+import (
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// TxIndexAnomalyDuplicate marks a transaction with the same block & index as a different transaction
+	TxIndexAnomalyDuplicate = "duplicate_index"
+	// TxIndexAnomalyNonceOrder marks a transaction whose index in a block is above that of a transaction of
+	// the same sender with a higher nonce, which is impossible on L1.
+	TxIndexAnomalyNonceOrder = "nonce_order"
+)
+
+// TxIndexAnomaly is a loaded transaction whose recorded index contradicts the other transactions of its
+// block. Such anomalies point at wrong fetch metadata, which breaks the derivation order of the frames.
+type TxIndexAnomaly struct {
+	BlockNumber uint64      `json:"block_number"`
+	TxIndex     uint64      `json:"tx_index"`
+	TxHash      common.Hash `json:"transaction_hash"`
+	// PrevTxHash is the transaction preceding TxHash in the sorted order, with which it conflicts
+	PrevTxHash common.Hash `json:"prev_transaction_hash"`
+	// Reason is one of the TxIndexAnomaly constants
+	Reason string `json:"reason"`
+}
+
+// txIndexAnomalies checks the indices of the transactions of each block, which must be sorted by
+// sortTransactions. The indices of the loaded transactions need not be contiguous, as a block usually
+// contains other transactions between those to the batch inbox.
+func txIndexAnomalies(txns []fetch.TransactionWithMetadata) []TxIndexAnomaly {
+	var (
+		out []TxIndexAnomaly
+		// lastBySender is the last transaction of each sender in the current block
+		lastBySender = make(map[common.Address]fetch.TransactionWithMetadata)
+	)
+	for i, txm := range txns {
+		if i > 0 && txns[i-1].BlockNumber != txm.BlockNumber {
+			clear(lastBySender)
+		}
+		anomaly := func(prev fetch.TransactionWithMetadata, reason string) {
+			out = append(out, TxIndexAnomaly{
+				BlockNumber: txm.BlockNumber,
+				TxIndex:     txm.TxIndex,
+				TxHash:      txm.Tx.Hash(),
+				PrevTxHash:  prev.Tx.Hash(),
+				Reason:      reason,
+			})
+		}
+		if i > 0 {
+			prev := txns[i-1]
+			if prev.BlockNumber == txm.BlockNumber && prev.TxIndex == txm.TxIndex && prev.Tx.Hash() != txm.Tx.Hash() {
+				anomaly(prev, TxIndexAnomalyDuplicate)
+			}
+		}
+		if prev, ok := lastBySender[txm.Sender]; ok && prev.Tx.Nonce() >= txm.Tx.Nonce() {
+			anomaly(prev, TxIndexAnomalyNonceOrder)
+		}
+		lastBySender[txm.Sender] = txm
+	}
+	return out
+}
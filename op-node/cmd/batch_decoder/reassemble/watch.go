@@ -0,0 +1,179 @@
+package reassemble
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"text/template"
+
+	"github.com/ethereum-optimism/optimism/op-node/cmd/batch_decoder/fetch"
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/fsnotify/fsnotify"
+)
+
+// newDirectoryWatcher watches the InDirectory for new transaction files. It is created before the
+// initial pass, so that files created while the initial pass runs are not missed.
+func newDirectoryWatcher(config Config) (*fsnotify.Watcher, error) {
+	if config.Source != nil || config.InFile != "" || config.InArchive != "" || len(config.InDirectories) > 0 ||
+		strings.HasPrefix(config.InDirectory, "s3://") {
+		return nil, errors.New("watch mode requires a single local input directory")
+	}
+	if config.LegacyBatches {
+		return nil, errors.New("watch mode does not support legacy batches")
+	}
+	if config.statsOnly() || !config.usesOutDirectory() || (config.OutputFormat != "" && config.OutputFormat != OutputFormatJSON) {
+		return nil, errors.New("watch mode requires the json output format with an out directory")
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(config.InDirectory); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	return watcher, nil
+}
+
+// channelKey identifies a channel, distinguishing the channels of a reused ID.
+type channelKey struct {
+	id         derive.ChannelID
+	reuseIndex int
+}
+
+// channelWatcher incrementally updates the channels of the initial pass with the frames of new
+// transaction files & rewrites the files of the affected channels.
+type channelWatcher struct {
+	config    Config
+	rollupCfg *rollup.Config
+	filenames *template.Template
+
+	// channels holds the frames of the latest channel of each ID
+	channels map[derive.ChannelID]*channelFrames
+	ready    map[channelKey]bool
+	txHashes map[common.Hash]struct{}
+}
+
+func newChannelWatcher(config Config, rollupCfg *rollup.Config, channels []channelFrames, ready map[channelKey]bool) (*channelWatcher, error) {
+	filenames, err := newFilenameTemplate(config.FilenameTemplate)
+	if err != nil {
+		return nil, err
+	}
+	w := &channelWatcher{
+		config:    config,
+		rollupCfg: rollupCfg,
+		filenames: filenames,
+		channels:  make(map[derive.ChannelID]*channelFrames),
+		ready:     ready,
+		txHashes:  make(map[common.Hash]struct{}),
+	}
+	for i := range channels {
+		ch := &channels[i]
+		if latest, ok := w.channels[ch.id]; !ok || latest.reuseIndex < ch.reuseIndex {
+			w.channels[ch.id] = ch
+		}
+		for _, frame := range ch.frames {
+			w.txHashes[frame.TxHash] = struct{}{}
+		}
+	}
+	return w, nil
+}
+
+// run processes the created & written files until the context is cancelled.
+func (w *channelWatcher) run(ctx context.Context, watcher *fsnotify.Watcher) {
+	w.config.logger().Info("Watching for new transaction files", "dir", w.config.InDirectory)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			if strings.HasSuffix(event.Name, ChecksumSuffix) {
+				continue
+			}
+			w.addFile(event.Name)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			w.config.logger().Warn("Error watching input directory", "err", err)
+		}
+	}
+}
+
+// addFile loads the transaction file & updates the channels of its frames. Files which are already
+// known, e.g. from the initial pass, are ignored.
+func (w *channelWatcher) addFile(name string) {
+	txm, err := loadTransactionsFile(name)
+	if err != nil {
+		// The file may still be written, it is retried on its next write event
+		w.config.logger().Debug("Failed to load transaction file", "file", name, "err", err)
+		return
+	}
+	filter := transactionFilter{config: w.config}
+	if !filter.keep(txm) {
+		return
+	}
+	txns, rejected := splitRejectedSenders([]fetch.TransactionWithMetadata{txm})
+	if len(rejected) > 0 {
+		w.config.logger().Warn("Ignored transaction of invalid sender", "file", name, "sender", rejected[0].Sender)
+	}
+	if len(txns) == 0 {
+		return
+	}
+	hash := txns[0].Tx.Hash()
+	if _, ok := w.txHashes[hash]; ok {
+		return
+	}
+	w.txHashes[hash] = struct{}{}
+	channels, invalid := groupChannels(w.config, w.rollupCfg, txns)
+	if len(invalid) > 0 {
+		w.config.logger().Warn("Ignored frames with a zero channel ID", "file", name, "count", len(invalid))
+	}
+	for _, ch := range channels {
+		w.update(ch.id, ch.frames)
+	}
+}
+
+// update adds the frames to the latest channel of the ID, re-processes it & rewrites its files.
+// Frames included more than the channel timeout after the channel's last frame start a new channel,
+// like in splitReusedChannel.
+func (w *channelWatcher) update(id derive.ChannelID, frames []FrameWithMetadata) {
+	lgr := w.config.logger()
+	cf, ok := w.channels[id]
+	if !ok {
+		cf = &channelFrames{id: id}
+		w.channels[id] = cf
+	} else if timeout := w.config.channelTimeout(w.rollupCfg, frames[0].Timestamp); timeout != 0 && frames[0].InclusionBlock > cf.frames[len(cf.frames)-1].InclusionBlock+timeout {
+		lgr.Warn("Channel ID reused", "channel_id", id, "channels", cf.reuseIndex+2)
+		cf = &channelFrames{id: id, reused: true, reuseIndex: cf.reuseIndex + 1}
+		w.channels[id] = cf
+	}
+	cf.frames = append(cf.frames, frames...)
+
+	ch := ProcessFrames(w.config, w.rollupCfg, id, cf.frames)
+	ch.IDReused, ch.IDReuseIndex = cf.reused, cf.reuseIndex
+	postProcess(w.config, &ch)
+	key := channelKey{id, cf.reuseIndex}
+	if ch.IsReady && !w.ready[key] {
+		lgr.Info("Channel became ready", "channel_id", id, "frames", len(ch.Frames))
+	}
+	w.ready[key] = ch.IsReady
+	if w.config.ReadyOnly && !ch.IsReady {
+		return
+	}
+	filename, err := channelFilename(w.filenames, ch)
+	if err == nil {
+		_, err = writeChannelFile(w.config.OutDirectory, filename, w.config.dirPerm(), w.config.filePerm(), w.config.PrettyPrint, ch, nil)
+	}
+	if err = errors.Join(err, writeChannelExtras(w.config, ch)); err != nil {
+		lgr.Warn("Failed to write channel", "channel_id", id, "err", err)
+	}
+}